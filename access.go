@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// visiblePods returns a func reporting whether the caller of c may read a
+// pod's logs in namespace, by Kubernetes RBAC and by the scope of the API
+// key used.
+func visiblePods(c *gin.Context, kubeAuth *kubeAuthorizer, namespace string) func(pod string) bool {
+	rbac := kubeAuth.podFilter(c, namespace)
+	value, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return rbac
+	}
+	key := value.(*apiKey)
+	return func(pod string) bool {
+		return key.allowsNamespace(namespace) && key.allowsPod(pod) && rbac(pod)
+	}
+}
+
+// logsAccessMiddleware rejects callers who may not read the logs of the
+// :pod parameter, or of every pod in the namespace on routes without one:
+// callers with a Kubernetes token need get pods/log, and callers with a
+// named API key need it in scope. Routes with download set also need the
+// key's download permission.
+func logsAccessMiddleware(kubeAuth *kubeAuthorizer, defaultNamespace string, download bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		namespace := c.GetString("namespace")
+		if namespace == "" {
+			namespace = defaultNamespace
+		}
+		pod := c.Param("pod")
+		target := "pods/log"
+		if pod != "" {
+			target += " " + pod
+		}
+
+		if value, ok := c.Get(apiKeyContextKey); ok {
+			key := value.(*apiKey)
+			if !key.allowsNamespace(namespace) || !key.allowsPod(pod) {
+				authFailures.WithLabelValues(authFailureForbidden).Inc()
+				c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key %q does not cover %s in namespace %s", key.Name, target, namespace)})
+				c.Abort()
+				return
+			}
+			if download && !key.canDownload() {
+				authFailures.WithLabelValues(authFailureForbidden).Inc()
+				c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key %q may not download logs", key.Name)})
+				c.Abort()
+				return
+			}
+		}
+
+		if value, ok := c.Get(kubeUserKey); ok && kubeAuth != nil {
+			user := value.(*authenticationv1.UserInfo)
+			allowed, err := kubeAuth.canReadLogs(c.Request.Context(), user, namespace, pod)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+			if !allowed {
+				authFailures.WithLabelValues(authFailureForbidden).Inc()
+				c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("%s may not get %s in namespace %s", user.Username, target, namespace)})
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
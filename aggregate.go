@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// A container stream that ends while the container still runs is reopened
+// after aggregateReopenDelay, doubling on each attempt up to
+// aggregateMaxReopenDelay.
+const (
+	aggregateReopenDelay    = time.Second
+	aggregateMaxReopenDelay = 30 * time.Second
+)
+
+// aggregateColorCount is the number of distinct color indexes handed out to
+// containers in an aggregated stream. Clients map the index onto a palette.
+const aggregateColorCount = 12
+
+// colorIndex returns a stable color index for a pod/container pair so the
+// same container keeps its color across reconnects and server restarts.
+func colorIndex(pod, container string) int {
+	h := fnv.New32a()
+	h.Write([]byte(pod + "/" + container))
+	return int(h.Sum32() % aggregateColorCount)
+}
+
+// aggregateStream follows every running container of the pods matching a
+// label selector and merges their lines onto one WebSocket connection.
+type aggregateStream struct {
+	clientset kubernetes.Interface
+	pods      *podCache
+	selector  labels.Selector
+	baseOpts  *corev1.PodLogOptions
+	limits    tailLimits
+	filter    *lineFilter
+	conn      *wsSession
+
+	mu sync.Mutex
+	// streams holds the cancel func of each active container stream keyed
+	// by container ID, and podOf maps the IDs followed so far to their pod.
+	streams map[string]context.CancelFunc
+	podOf   map[string]string
+	// instances holds the container ID last followed for each pod/container
+	// name, so a restarted container is read from its start instead of
+	// tailed.
+	instances map[string]string
+	// positions holds, by container ID, the resume point of the last line
+	// relayed, so a stream that ends while its container still runs picks
+	// up where it stopped.
+	positions map[string]string
+	stopped   bool
+	wg        sync.WaitGroup
+}
+
+func newAggregateStream(clientset kubernetes.Interface, pods *podCache, selector labels.Selector, baseOpts *corev1.PodLogOptions, limits tailLimits, filter *lineFilter, conn *wsSession) *aggregateStream {
+	return &aggregateStream{
+		clientset: clientset,
+		pods:      pods,
+		selector:  selector,
+		baseOpts:  baseOpts,
+		limits:    limits,
+		filter:    filter,
+		conn:      conn,
+		streams:   map[string]context.CancelFunc{},
+		podOf:     map[string]string{},
+		instances: map[string]string{},
+		positions: map[string]string{},
+	}
+}
+
+// send writes a message to the client.
+func (a *aggregateStream) send(msg gin.H) error {
+	return a.conn.WriteJSON(msg)
+}
+
+// run follows the selected pods until ctx is cancelled, starting and
+// stopping container streams as the pod cache reports changes.
+func (a *aggregateStream) run(ctx context.Context) {
+	unsubscribe, err := a.pods.subscribe(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			pod, ok := podFromDeleteEvent(obj)
+			return ok && a.selector.Matches(labels.Set(pod.Labels))
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				a.syncPod(ctx, obj.(*corev1.Pod))
+			},
+			UpdateFunc: func(_, obj interface{}) {
+				a.syncPod(ctx, obj.(*corev1.Pod))
+			},
+			DeleteFunc: func(obj interface{}) {
+				if pod, ok := podFromDeleteEvent(obj); ok {
+					a.stopPod(pod.Name)
+				}
+			},
+		},
+	})
+	if err != nil {
+		a.send(gin.H{"error": err.Error()})
+		return
+	}
+	defer unsubscribe()
+
+	<-ctx.Done()
+}
+
+// syncPod starts a stream for every running container instance of pod that
+// is not already being followed, and drops pods that have terminated.
+func (a *aggregateStream) syncPod(ctx context.Context, pod *corev1.Pod) {
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		a.stopPod(pod.Name)
+		return
+	}
+
+	statuses := append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	statuses = append(statuses, pod.Status.EphemeralContainerStatuses...)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stopped {
+		return
+	}
+	for _, status := range statuses {
+		if status.State.Running == nil || status.ContainerID == "" {
+			continue
+		}
+		if _, ok := a.streams[status.ContainerID]; ok {
+			continue
+		}
+
+		opts, resume := a.logOptions(pod.Name, status)
+		streamCtx, cancel := context.WithCancel(ctx)
+		a.streams[status.ContainerID] = cancel
+		a.podOf[status.ContainerID] = pod.Name
+		a.wg.Add(1)
+		go a.follow(streamCtx, pod.Name, status.ContainerID, opts, resume)
+	}
+}
+
+// logOptions returns the options to follow a container instance with, and
+// where to resume it if it was followed before. a.mu must be held.
+func (a *aggregateStream) logOptions(podName string, status corev1.ContainerStatus) (*corev1.PodLogOptions, *resumePoint) {
+	opts := *a.baseOpts
+	opts.Container = status.Name
+	opts.Follow = true
+	opts.Previous = false
+	opts.Timestamps = true
+
+	key := podName + "/" + status.Name
+	previous, followed := a.instances[key]
+	a.instances[key] = status.ContainerID
+	if position, ok := a.positions[status.ContainerID]; ok {
+		// The stream ended while the container kept running, e.g. when
+		// the API server dropped it: continue after the last line relayed
+		if resume, err := parseResumePoint(position); err == nil {
+			resume.apply(&opts, a.limits)
+			return &opts, resume
+		}
+	}
+	if followed && previous != status.ContainerID {
+		// A new instance of a container we already followed: read it from
+		// the start so nothing written since the restart is lost.
+		opts.TailLines = nil
+	}
+	return &opts, nil
+}
+
+// stop cancels every container stream and waits for them to finish. No new
+// streams are started afterwards.
+func (a *aggregateStream) stop() {
+	a.mu.Lock()
+	a.stopped = true
+	for _, cancel := range a.streams {
+		cancel()
+	}
+	a.mu.Unlock()
+	a.wg.Wait()
+}
+
+// stopPod cancels all streams belonging to the named pod and forgets where
+// they were.
+func (a *aggregateStream) stopPod(podName string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, pod := range a.podOf {
+		if pod != podName {
+			continue
+		}
+		if cancel, ok := a.streams[id]; ok {
+			cancel()
+		}
+		delete(a.podOf, id)
+		delete(a.positions, id)
+	}
+}
+
+// follow relays one container's log stream until ctx is done or the
+// container stops running. A stream that ends or fails while the cached pod
+// still reports the container running is reopened after a backoff,
+// resuming after the last line relayed.
+func (a *aggregateStream) follow(ctx context.Context, podName, containerID string, opts *corev1.PodLogOptions, resume *resumePoint) {
+	defer a.wg.Done()
+	defer func() {
+		a.mu.Lock()
+		a.streams[containerID]()
+		delete(a.streams, containerID)
+		a.mu.Unlock()
+	}()
+
+	delay := aggregateReopenDelay
+	for {
+		started := time.Now()
+		err := a.relay(ctx, podName, containerID, opts, resume)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			a.send(gin.H{"pod": podName, "container": opts.Container, "color": colorIndex(podName, opts.Container), "error": err.Error()})
+		}
+		if time.Since(started) > aggregateMaxReopenDelay {
+			// It ran for a while, so this isn't a stream failing in a loop
+			delay = aggregateReopenDelay
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		delay = min(2*delay, aggregateMaxReopenDelay)
+
+		a.mu.Lock()
+		status, ok := a.running(podName, containerID)
+		if ok {
+			opts, resume = a.logOptions(podName, status)
+		}
+		a.mu.Unlock()
+		if !ok {
+			return
+		}
+	}
+}
+
+// running returns the status of the container instance with containerID if
+// the cached pod still reports it running and it is still followed. a.mu
+// must be held.
+func (a *aggregateStream) running(podName, containerID string) (corev1.ContainerStatus, bool) {
+	if _, ok := a.podOf[containerID]; !ok || a.stopped {
+		return corev1.ContainerStatus{}, false
+	}
+	pod, err := a.pods.get(podName)
+	if err != nil {
+		return corev1.ContainerStatus{}, false
+	}
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses, pod.Status.EphemeralContainerStatuses} {
+		for _, status := range statuses {
+			if status.ContainerID == containerID && status.State.Running != nil {
+				return status, true
+			}
+		}
+	}
+	return corev1.ContainerStatus{}, false
+}
+
+// relay opens one container's log stream and relays it until it ends or
+// ctx is done, recording the position of each line relayed. The error
+// opening or reading the stream, if any, is returned.
+func (a *aggregateStream) relay(ctx context.Context, podName, containerID string, opts *corev1.PodLogOptions, resume *resumePoint) error {
+	color := colorIndex(podName, opts.Container)
+	keepTimestamps := a.baseOpts.Timestamps
+	req := a.clientset.CoreV1().Pods(a.pods.namespace).GetLogs(podName, opts)
+	logStream, err := openLogStream(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer logStream.Close()
+
+	// Closing the stream unblocks the scanner when the pod goes away.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			logStream.Close()
+		case <-done:
+		}
+	}()
+
+	return followLogs(logStream, a.filter, keepTimestamps, resume, func(timestamp string, msg gin.H) error {
+		msg["pod"] = podName
+		msg["container"] = opts.Container
+		msg["color"] = color
+		if err := a.send(msg); err != nil {
+			return err
+		}
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if _, ok := a.podOf[containerID]; ok && timestamp != "" {
+			a.positions[containerID] = formatResumePoint(timestamp, msg["hash"].(string))
+		}
+		return nil
+	})
+}
+
+// aggregateLogsHandler serves /ws/logs?selector=..., following every
+// container of the matching pods and merging them into one stream.
+func aggregateLogsHandler(clientset kubernetes.Interface, namespaces *namespaceRegistry, upgrader *websocket.Upgrader, drainer *drainer, limits tailLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		selector := c.Query("selector")
+		if selector == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "selector parameter is required"})
+			return
+		}
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid selector %q: %v", selector, err)})
+			return
+		}
+
+		baseOpts, err := logOptionsFromQuery(c, "", limits)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter, err := lineFilterFromQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pods := namespaces.cache(c.GetString("namespace"))
+		if err := pods.waitForSync(c.Request.Context()); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+
+		conn, ok := upgradeSession(c, upgrader, drainer)
+		if !ok {
+			return
+		}
+		defer conn.Close()
+
+		stream := newAggregateStream(clientset, pods, parsed, baseOpts, limits, filter, conn)
+		stream.run(conn.ctx)
+		stream.stop()
+	}
+}
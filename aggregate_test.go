@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestColorIndexStable tests that a pod/container pair always maps to the same color in range
+func TestColorIndexStable(t *testing.T) {
+	first := colorIndex("checkout-7d9f", "app")
+	assert.Equal(t, first, colorIndex("checkout-7d9f", "app"))
+	assert.GreaterOrEqual(t, first, 0)
+	assert.Less(t, first, aggregateColorCount)
+}
+
+// labeledPod is testPod with labels and a container ID for each running
+// container, as the aggregated stream follows container instances.
+func labeledPod(name string, labels map[string]string, containers ...string) *corev1.Pod {
+	pod := testPod(name, containers...)
+	pod.Labels = labels
+	for i := range pod.Status.ContainerStatuses {
+		pod.Status.ContainerStatuses[i].ContainerID = "containerd://" + name + "-" + pod.Status.ContainerStatuses[i].Name
+	}
+	return pod
+}
+
+// TestAggregateLogs tests that lines from every matching pod are merged and tagged, following pods as they come and go
+func TestAggregateLogs(t *testing.T) {
+	clientset := fake.NewSimpleClientset(labeledPod("web-1", map[string]string{"app": "web"}, "app"))
+	server := httptest.NewServer(newTestRouterWith(t, func(opts *routerOptions) { opts.clientset = clientset }))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/logs?selector=app%3Dweb", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	next := func() map[string]interface{} {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg map[string]interface{}
+		require.NoError(t, conn.ReadJSON(&msg))
+		return msg
+	}
+
+	msg := next()
+	assert.Equal(t, "web-1", msg["pod"])
+	assert.Equal(t, "app", msg["container"])
+	assert.Equal(t, float64(colorIndex("web-1", "app")), msg["color"])
+	assert.Equal(t, "fake logs", msg["log"])
+
+	// Pods that don't match are left out; new matching ones are picked up
+	pods := clientset.CoreV1().Pods("default")
+	ctx := context.Background()
+	_, err = pods.Create(ctx, labeledPod("db-1", map[string]string{"app": "db"}, "postgres"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = pods.Create(ctx, labeledPod("web-2", map[string]string{"app": "web"}, "app", "proxy"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	containers := map[string]bool{}
+	for len(containers) < 2 {
+		msg := next()
+		if msg["pod"] == "web-1" {
+			// web-1's stream was reopened after it ended
+			continue
+		}
+		assert.Equal(t, "web-2", msg["pod"])
+		assert.Equal(t, float64(colorIndex("web-2", msg["container"].(string))), msg["color"])
+		containers[msg["container"].(string)] = true
+	}
+	assert.Equal(t, map[string]bool{"app": true, "proxy": true}, containers)
+
+	// Once web-2 is gone only web-1 is followed, and web-2's streams aren't
+	// reopened
+	require.NoError(t, pods.Delete(ctx, "web-2", metav1.DeleteOptions{}))
+	time.Sleep(100 * time.Millisecond)
+	proxyStreams := len(logRequests(clientset, "proxy"))
+	for {
+		msg := next()
+		if msg["pod"] == "web-1" {
+			break
+		}
+		assert.Equal(t, "web-2", msg["pod"], "sent before the delete")
+	}
+	assert.Len(t, logRequests(clientset, "proxy"), proxyStreams)
+}
+
+// logRequests returns the options of every log stream the fake clientset
+// was asked for on the named container.
+func logRequests(clientset *fake.Clientset, container string) []*corev1.PodLogOptions {
+	var requests []*corev1.PodLogOptions
+	for _, action := range clientset.Actions() {
+		if action.GetSubresource() != "log" {
+			continue
+		}
+		if opts, ok := action.(k8stesting.GenericAction).GetValue().(*corev1.PodLogOptions); ok && opts.Container == container {
+			requests = append(requests, opts)
+		}
+	}
+	return requests
+}
+
+// TestAggregateLogsReopensEndedStream tests that a stream ending while its container keeps running is reopened without a pod update
+func TestAggregateLogsReopensEndedStream(t *testing.T) {
+	clientset := fake.NewSimpleClientset(labeledPod("web-1", map[string]string{"app": "web"}, "app"))
+	server := httptest.NewServer(newTestRouterWith(t, func(opts *routerOptions) { opts.clientset = clientset }))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/logs?selector=app%3Dweb", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The fake stream ends after one line; the second comes from reopening it
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg map[string]interface{}
+		require.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, "web-1", msg["pod"])
+		assert.Equal(t, "fake logs", msg["log"])
+	}
+
+	// The container is the same one and no line had a timestamp to resume
+	// from, so it is tailed again rather than read from the start
+	requests := logRequests(clientset, "app")
+	require.Len(t, requests, 2)
+	require.NotNil(t, requests[1].TailLines)
+	assert.Equal(t, int64(100), *requests[1].TailLines)
+	assert.Nil(t, requests[1].SinceTime)
+}
+
+// TestAggregateRunning tests that only a followed container instance the cache still reports running is reopened
+func TestAggregateRunning(t *testing.T) {
+	pod := labeledPod("web-1", map[string]string{"app": "web"}, "app")
+	clientset := fake.NewSimpleClientset(pod)
+	pods := newPodCache(clientset, "default")
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	pods.start(stopCh)
+	require.NoError(t, pods.waitForSync(context.Background()))
+
+	a := newAggregateStream(clientset, pods, nil, &corev1.PodLogOptions{}, tailLimits{}, nil, nil)
+	id := pod.Status.ContainerStatuses[0].ContainerID
+	_, ok := a.running("web-1", id)
+	assert.False(t, ok, "not followed")
+
+	a.podOf[id] = "web-1"
+	status, ok := a.running("web-1", id)
+	assert.True(t, ok)
+	assert.Equal(t, "app", status.Name)
+	_, ok = a.running("web-1", "containerd://other")
+	assert.False(t, ok, "another instance")
+	_, ok = a.running("web-2", id)
+	assert.False(t, ok, "pod gone")
+}
+
+// TestAggregateLogOptions tests how a container is followed again: resumed if its stream dropped, from the start if it restarted
+func TestAggregateLogOptions(t *testing.T) {
+	lines := int64(100)
+	a := newAggregateStream(nil, nil, nil, &corev1.PodLogOptions{TailLines: &lines}, tailLimits{defaultLines: 100}, nil, nil)
+	status := corev1.ContainerStatus{Name: "app", ContainerID: "containerd://1"}
+
+	opts, resume := a.logOptions("web-1", status)
+	assert.Nil(t, resume)
+	assert.Equal(t, &lines, opts.TailLines, "first follow tails")
+	assert.True(t, opts.Follow)
+	assert.True(t, opts.Timestamps)
+
+	opts, resume = a.logOptions("web-1", status)
+	assert.Nil(t, resume)
+	assert.Equal(t, &lines, opts.TailLines, "nothing relayed yet, so tail again")
+
+	a.positions[status.ContainerID] = "2026-10-17T09:00:05.5Z," + lineHash("last")
+	opts, resume = a.logOptions("web-1", status)
+	require.NotNil(t, resume)
+	assert.Nil(t, opts.TailLines)
+	assert.Equal(t, time.Date(2026, 10, 17, 9, 0, 5, 0, time.UTC), opts.SinceTime.Time.UTC())
+
+	restarted := corev1.ContainerStatus{Name: "app", ContainerID: "containerd://2"}
+	opts, resume = a.logOptions("web-1", restarted)
+	assert.Nil(t, resume)
+	assert.Nil(t, opts.TailLines, "a new instance is read from its start")
+	assert.Nil(t, opts.SinceTime)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// apiKeyReloadInterval is how often the key file is checked for changes,
+// so keys can be added, rotated and revoked by updating a Secret.
+const apiKeyReloadInterval = 30 * time.Second
+
+// apiKeyContextKey is the gin context key holding the apiKey a request
+// was authenticated with.
+const apiKeyContextKey = "apiKey"
+
+// Values of an API key's permission.
+const (
+	permissionRead     = "read"
+	permissionDownload = "download"
+)
+
+// apiKey is one named key from the key file:
+//
+//	keys:
+//	- name: ci
+//	  key: s3cret
+//	  expires: 2026-12-31T00:00:00Z
+//	  namespaces: ["team-*"]
+//	  pods: ["web-*"]
+//	  permission: download
+type apiKey struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	// Expires, if set, is when the key stops working.
+	Expires *time.Time `json:"expires,omitempty"`
+	// Namespaces and Pods are globs limiting what the key reads; empty
+	// allows everything.
+	Namespaces []string `json:"namespaces,omitempty"`
+	Pods       []string `json:"pods,omitempty"`
+	// Permission is "read" (the default) for viewing and streaming logs,
+	// or "download" to also allow downloads and bundles.
+	Permission string `json:"permission,omitempty"`
+}
+
+type apiKeyFile struct {
+	Keys []apiKey `json:"keys"`
+}
+
+// matchesAny reports whether name matches one of globs, or globs is empty.
+func matchesAny(globs []string, name string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsNamespace reports whether the key may read logs in namespace.
+func (k *apiKey) allowsNamespace(namespace string) bool {
+	return matchesAny(k.Namespaces, namespace)
+}
+
+// allowsPod reports whether the key may read pod's logs, or every pod's
+// when pod is empty.
+func (k *apiKey) allowsPod(pod string) bool {
+	if pod == "" {
+		return len(k.Pods) == 0 || contains(k.Pods, "*")
+	}
+	return matchesAny(k.Pods, pod)
+}
+
+func (k *apiKey) canDownload() bool {
+	return k.Permission == permissionDownload
+}
+
+func (k *apiKey) expired(now time.Time) bool {
+	return k.Expires != nil && !now.Before(*k.Expires)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyStore serves the keys of a key file, reloading it when it changes.
+// A reload that fails keeps the previous keys in use.
+type apiKeyStore struct {
+	path string
+
+	mu      sync.RWMutex
+	keys    []apiKey
+	hashes  [][sha256.Size]byte
+	modTime time.Time
+}
+
+// newAPIKeyStore loads the key file at path, failing if it is unusable.
+func newAPIKeyStore(path string) (*apiKeyStore, error) {
+	s := &apiKeyStore{path: path}
+	if _, err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseAPIKeys reads and checks a key file.
+func parseAPIKeys(data []byte) ([]apiKey, error) {
+	var file apiKeyFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	values := map[string]bool{}
+	for i := range file.Keys {
+		k := &file.Keys[i]
+		switch {
+		case k.Name == "":
+			return nil, fmt.Errorf("key %d has no name", i+1)
+		case names[k.Name]:
+			return nil, fmt.Errorf("key name %q is used twice", k.Name)
+		case k.Key == "":
+			return nil, fmt.Errorf("key %q has no key", k.Name)
+		case values[k.Key]:
+			return nil, fmt.Errorf("key %q has the same key as another", k.Name)
+		}
+		names[k.Name] = true
+		values[k.Key] = true
+		if k.Permission == "" {
+			k.Permission = permissionRead
+		}
+		if k.Permission != permissionRead && k.Permission != permissionDownload {
+			return nil, fmt.Errorf("key %q: permission must be %q or %q, not %q", k.Name, permissionRead, permissionDownload, k.Permission)
+		}
+		for _, glob := range append(append([]string{}, k.Namespaces...), k.Pods...) {
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("key %q: invalid glob %q", k.Name, glob)
+			}
+		}
+	}
+	return file.Keys, nil
+}
+
+// reload reads the file again if it has changed since the last load and
+// reports whether it did.
+func (s *apiKeyStore) reload() (bool, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	unchanged := info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, fmt.Errorf("reading key file: %v", err)
+	}
+	keys, err := parseAPIKeys(data)
+	if err != nil {
+		return false, fmt.Errorf("parsing key file %s: %v", s.path, err)
+	}
+	hashes := make([][sha256.Size]byte, len(keys))
+	for i, k := range keys {
+		hashes[i] = sha256.Sum256([]byte(k.Key))
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.hashes = hashes
+	s.modTime = info.ModTime()
+	s.mu.Unlock()
+	return true, nil
+}
+
+// watch reloads the file every interval until stopCh is closed.
+func (s *apiKeyStore) watch(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			reloaded, err := s.reload()
+			if err != nil {
+				fmt.Println("API key reload failed, keeping the current keys:", err)
+			} else if reloaded {
+				fmt.Println("API keys reloaded")
+			}
+		}
+	}
+}
+
+// lookup returns the unexpired key matching key. Every key is compared, in
+// constant time over hashes of equal length, so timing reveals neither
+// the key nor which one matched.
+func (s *apiKeyStore) lookup(key string) (*apiKey, bool) {
+	hash := sha256.Sum256([]byte(key))
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	match := -1
+	for i := range s.hashes {
+		if subtle.ConstantTimeCompare(hash[:], s.hashes[i][:]) == 1 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return nil, false
+	}
+	k := s.keys[match]
+	if k.expired(time.Now()) {
+		fmt.Printf("API key %q has expired\n", k.Name)
+		return nil, false
+	}
+	return &k, true
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKeyFile = `
+keys:
+- name: viewer
+  key: viewer-key
+  pods: ["web-*"]
+- name: downloader
+  key: downloader-key
+  permission: download
+- name: other-team
+  key: other-team-key
+  namespaces: ["team-*"]
+- name: retired
+  key: retired-key
+  expires: 2020-01-01T00:00:00Z
+`
+
+func writeKeyFile(t *testing.T, path, content string, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+// TestParseAPIKeysErrors tests that unusable key files are rejected
+func TestParseAPIKeysErrors(t *testing.T) {
+	cases := map[string]string{
+		"keys:\n- key: abc\n":                               "has no name",
+		"keys:\n- name: a\n":                                "has no key",
+		"keys:\n- {name: a, key: x}\n- {name: a, key: y}\n": "used twice",
+		"keys:\n- {name: a, key: x}\n- {name: b, key: x}\n": "same key",
+		"keys:\n- {name: a, key: x, permission: admin}\n":   "permission must be",
+		"keys:\n- {name: a, key: x, pods: [\"[\"]}\n":       "invalid glob",
+		"keys:\n- {name: a, key: x, expires: tomorrow}\n":   "",
+		"keys:\n- {name: a, key: x, scope: everything}\n":   "unknown field",
+	}
+	for content, want := range cases {
+		_, err := parseAPIKeys([]byte(content))
+		if assert.Error(t, err, content) {
+			assert.Contains(t, err.Error(), want, content)
+		}
+	}
+}
+
+// TestAPIKeyStoreReload tests that key changes apply without a restart and a broken file keeps the old keys
+func TestAPIKeyStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	writeKeyFile(t, path, "keys:\n- {name: first, key: one}\n", time.Now().Add(-time.Minute))
+
+	store, err := newAPIKeyStore(path)
+	require.NoError(t, err)
+	key, ok := store.lookup("one")
+	require.True(t, ok)
+	assert.Equal(t, "first", key.Name)
+	assert.Equal(t, permissionRead, key.Permission)
+	_, ok = store.lookup("on")
+	assert.False(t, ok)
+
+	writeKeyFile(t, path, "keys:\n- {name: second, key: two}\n", time.Now())
+	reloaded, err := store.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	_, ok = store.lookup("one")
+	assert.False(t, ok, "removed keys stop working")
+	_, ok = store.lookup("two")
+	assert.True(t, ok)
+
+	writeKeyFile(t, path, "keys: [", time.Now().Add(time.Minute))
+	_, err = store.reload()
+	assert.Error(t, err)
+	_, ok = store.lookup("two")
+	assert.True(t, ok, "a broken file keeps the last good keys")
+}
+
+// TestAPIKeyScopes tests that named keys only reach what their scope and permission allow
+func TestAPIKeyScopes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	writeKeyFile(t, path, testKeyFile, time.Now())
+	store, err := newAPIKeyStore(path)
+	require.NoError(t, err)
+
+	router := newTestRouterWith(t, func(opts *routerOptions) { opts.apiKeys = store }, testPod("web-1", "app"), testPod("db-1", "app"))
+
+	cases := []struct {
+		key  string
+		path string
+		want int
+	}{
+		{"", "/api/logs/web-1/app", http.StatusForbidden},
+		{"viewer-key", "/api/logs/web-1/app", http.StatusOK},
+		{"viewer-key", "/api/logs/db-1/app", http.StatusForbidden},
+		{"viewer-key", "/api/logs/web-1/app/download", http.StatusForbidden},
+		{"viewer-key", "/api/logs/all", http.StatusForbidden},
+		{"downloader-key", "/api/logs/db-1/app/download", http.StatusOK},
+		{"downloader-key", "/api/bundle", http.StatusOK},
+		{"downloader-key", "/api/logs/all", http.StatusOK},
+		{"other-team-key", "/api/logs/web-1/app", http.StatusForbidden},
+		{"retired-key", "/api/logs/web-1/app", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		req.Header.Set("X-API-Key", tc.key)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.want, w.Code, "%s %s", tc.key, tc.path)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/containers?key=viewer-key", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Containers []PodContainer `json:"containers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Containers, 1)
+	assert.Equal(t, "web-1", body.Containers[0].PodName)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authMethodKey is the gin context key naming how a request authenticated:
+// one of the authMethod values.
+const authMethodKey = "authMethod"
+
+// Values of authMethodKey.
+const (
+	authMethodNone       = "none"
+	authMethodKubernetes = "kubernetes"
+	authMethodOIDC       = "oidc"
+	authMethodAPIKey     = "apiKey"
+	authMethodLogKey     = "logKey"
+)
+
+// auditBytesKey is the gin context key of the *atomic.Int64 counting what a
+// WebSocket sent. gin's writer doesn't see writes to a hijacked connection.
+const auditBytesKey = "auditBytes"
+
+// secretParams are query parameters that carry credentials, including the
+// authorization code and state of the OIDC callback. They are redacted from
+// the access log and left out of audit events.
+var secretParams = []string{"key", "token", "access_token", "ticket", "code", "state"}
+
+// Webhook delivery: events queue up to auditQueueSize and are posted in
+// batches of up to auditBatchSize. When the webhook can't keep up, events
+// are dropped from it (never from the log) rather than slowing requests.
+const (
+	auditQueueSize      = 1000
+	auditBatchSize      = 100
+	auditWebhookTimeout = 10 * time.Second
+)
+
+// auditEvent records one request for logs.
+type auditEvent struct {
+	Time time.Time `json:"time"`
+	// Auth is how the caller authenticated, User who they are and APIKey
+	// the name of the key they used, if any.
+	Auth     string `json:"auth"`
+	User     string `json:"user,omitempty"`
+	APIKey   string `json:"apiKey,omitempty"`
+	SourceIP string `json:"sourceIP"`
+	Method   string `json:"method"`
+	// Endpoint is the route, e.g. /api/logs/:pod/:container, and Path
+	// the path requested.
+	Endpoint  string `json:"endpoint"`
+	Path      string `json:"path"`
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+	// Options are the query parameters used, without credentials.
+	Options    map[string]string `json:"options,omitempty"`
+	Status     int               `json:"status"`
+	Bytes      int64             `json:"bytes"`
+	DurationMS int64             `json:"durationMs"`
+}
+
+// auditor writes audit events as JSON lines and optionally posts them to a
+// webhook.
+type auditor struct {
+	mu  sync.Mutex
+	out io.Writer
+	// file is closed with the auditor when out is a file
+	file *os.File
+
+	webhook string
+	client  *http.Client
+	queue   chan auditEvent
+	dropped atomic.Int64
+	done    chan struct{}
+}
+
+// newAuditor opens the audit log: "stdout", "-" or "" for standard output,
+// or a file to append to. A non-empty webhook also receives every event.
+func newAuditor(log, webhook string) (*auditor, error) {
+	a := &auditor{out: os.Stdout, webhook: webhook}
+	if log != "" && log != "stdout" && log != "-" {
+		f, err := os.OpenFile(log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("opening audit log: %v", err)
+		}
+		a.out = f
+		a.file = f
+	}
+	if webhook != "" {
+		if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("audit webhook %q is not an http(s) URL", redactURL(webhook))
+		}
+		a.client = &http.Client{Timeout: auditWebhookTimeout}
+		a.queue = make(chan auditEvent, auditQueueSize)
+		a.done = make(chan struct{})
+		go a.deliver()
+	}
+	return a, nil
+}
+
+// record writes e to the log and queues it for the webhook.
+func (a *auditor) record(e auditEvent) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		fmt.Println("Audit event not recorded:", err)
+		return
+	}
+	a.mu.Lock()
+	_, err = a.out.Write(append(line, '\n'))
+	a.mu.Unlock()
+	if err != nil {
+		fmt.Println("Audit log write failed:", err)
+	}
+
+	if a.queue != nil {
+		select {
+		case a.queue <- e:
+		default:
+			if a.dropped.Add(1) == 1 {
+				fmt.Println("Audit webhook is falling behind, dropping events")
+			}
+		}
+	}
+}
+
+// deliver posts queued events to the webhook until the queue is closed.
+func (a *auditor) deliver() {
+	defer close(a.done)
+	for e := range a.queue {
+		batch := []auditEvent{e}
+	fill:
+		for len(batch) < auditBatchSize {
+			select {
+			case e, ok := <-a.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, e)
+			default:
+				break fill
+			}
+		}
+		if err := a.post(batch); err != nil {
+			fmt.Printf("Audit webhook failed, %d events not delivered: %v\n", len(batch), err)
+		}
+		if n := a.dropped.Swap(0); n > 0 {
+			fmt.Printf("Audit webhook dropped %d events\n", n)
+		}
+	}
+}
+
+// post sends a batch to the webhook as a JSON array.
+func (a *auditor) post(batch []auditEvent) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.Post(a.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// The URL may hold a token
+		if uerr, ok := err.(*url.Error); ok {
+			return uerr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// close delivers what is queued for the webhook, waiting up to timeout, and
+// closes the log file.
+func (a *auditor) close(timeout time.Duration) {
+	if a.queue != nil {
+		close(a.queue)
+		select {
+		case <-a.done:
+		case <-time.After(timeout):
+			fmt.Println("Audit webhook did not finish delivering in time")
+		}
+	}
+	if a.file != nil {
+		a.file.Close()
+	}
+}
+
+// middleware records every request it handles once it finishes, including
+// denied ones. defaultNamespace is used for routes without one. A nil
+// auditor records nothing.
+func (a *auditor) middleware(defaultNamespace string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a == nil {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		wsBytes := new(atomic.Int64)
+		c.Set(auditBytesKey, wsBytes)
+		c.Next()
+
+		e := auditEvent{
+			Time:       start.UTC(),
+			Auth:       c.GetString(authMethodKey),
+			User:       c.GetString(userKey),
+			SourceIP:   c.ClientIP(),
+			Method:     c.Request.Method,
+			Endpoint:   c.FullPath(),
+			Path:       c.Request.URL.Path,
+			Namespace:  c.GetString("namespace"),
+			Pod:        c.Param("pod"),
+			Container:  c.Param("container"),
+			Options:    auditOptions(c.Request.URL.Query()),
+			Status:     c.Writer.Status(),
+			Bytes:      wsBytes.Load(),
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if e.Auth == "" {
+			// Authentication failed or never ran
+			e.Auth = authMethodNone
+		}
+		if value, ok := c.Get(apiKeyContextKey); ok {
+			e.APIKey = value.(*apiKey).Name
+		}
+		if e.Namespace == "" {
+			e.Namespace = c.Param("ns")
+		}
+		if e.Namespace == "" {
+			e.Namespace = defaultNamespace
+		}
+		if c.IsWebsocket() && e.Status == http.StatusOK {
+			// The upgrade went through on the hijacked connection
+			e.Status = http.StatusSwitchingProtocols
+		}
+		if size := c.Writer.Size(); size > 0 {
+			e.Bytes += int64(size)
+		}
+		a.record(e)
+	}
+}
+
+// auditOptions flattens query parameters, leaving out credentials.
+func auditOptions(query url.Values) map[string]string {
+	options := map[string]string{}
+	for name, values := range query {
+		if contains(secretParams, name) {
+			continue
+		}
+		options[name] = strings.Join(values, ",")
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
+}
+
+// auditCounter returns the counter of bytes sent on c's WebSocket, or nil
+// if the request isn't audited.
+func auditCounter(c *gin.Context) *atomic.Int64 {
+	if value, ok := c.Get(auditBytesKey); ok {
+		return value.(*atomic.Int64)
+	}
+	return nil
+}
+
+// redactURL replaces the values of credential query parameters in a path
+// or URL, so request logs don't leak keys and tokens.
+func redactURL(raw string) string {
+	path, query, ok := strings.Cut(raw, "?")
+	if !ok {
+		return raw
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil && contains(secretParams, unescaped) {
+			params[i] = name + "=" + redactedValue
+		}
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+// accessLogFormatter is gin's default request log line with credentials
+// redacted from the path.
+func accessLogFormatter(param gin.LogFormatterParams) string {
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		redactURL(param.Path),
+		param.ErrorMessage,
+	)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer safe to read while the server writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) events(t *testing.T) []auditEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var events []auditEvent
+	scanner := bufio.NewScanner(bytes.NewReader(b.buf.Bytes()))
+	for scanner.Scan() {
+		var e auditEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e), scanner.Text())
+		events = append(events, e)
+	}
+	return events
+}
+
+// newAuditTestRouter serves web-1 with the named keys of testKeyFile,
+// auditing to the returned buffer.
+func newAuditTestRouter(t *testing.T) (http.Handler, *syncBuffer) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	writeKeyFile(t, path, testKeyFile, time.Now())
+	store, err := newAPIKeyStore(path)
+	require.NoError(t, err)
+
+	out := &syncBuffer{}
+	return newTestRouterWith(t, func(opts *routerOptions) {
+		opts.apiKeys = store
+		opts.auditor = &auditor{out: out}
+	}, testPod("web-1", "app")), out
+}
+
+// TestAuditLog tests that log reads are recorded with who, what and how much, without the key
+func TestAuditLog(t *testing.T) {
+	router, out := newAuditTestRouter(t)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/logs/web-1/app?lines=10&key=viewer-key", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/logs/web-1/app", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// Listing containers isn't log access
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/containers?key=viewer-key", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	events := out.events(t)
+	require.Len(t, events, 2)
+	read := events[0]
+	assert.Equal(t, authMethodAPIKey, read.Auth)
+	assert.Equal(t, "viewer", read.APIKey)
+	assert.Equal(t, "10.1.2.3", read.SourceIP)
+	assert.Equal(t, "/api/logs/:pod/:container", read.Endpoint)
+	assert.Equal(t, "default", read.Namespace)
+	assert.Equal(t, "web-1", read.Pod)
+	assert.Equal(t, "app", read.Container)
+	assert.Equal(t, map[string]string{"lines": "10"}, read.Options)
+	assert.Equal(t, http.StatusOK, read.Status)
+	assert.Positive(t, read.Bytes)
+
+	denied := events[1]
+	assert.Equal(t, authMethodNone, denied.Auth)
+	assert.Equal(t, http.StatusForbidden, denied.Status)
+	assert.NotContains(t, out.buf.String(), "viewer-key")
+}
+
+// TestAuditLogWebSocket tests that bytes sent on a WebSocket are counted
+func TestAuditLogWebSocket(t *testing.T) {
+	router, out := newAuditTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/logs/web-1/app?key=viewer-key", nil)
+	require.NoError(t, err)
+	_, msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+	conn.Close()
+
+	require.Eventually(t, func() bool { return len(out.events(t)) == 1 }, 5*time.Second, 10*time.Millisecond)
+	e := out.events(t)[0]
+	assert.Equal(t, "/ws/logs/:pod/:container", e.Endpoint)
+	assert.Equal(t, http.StatusSwitchingProtocols, e.Status)
+	assert.GreaterOrEqual(t, e.Bytes, int64(len(msg)))
+}
+
+// TestAuditWebhook tests that events are posted to the webhook and flushed on close
+func TestAuditWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var received []auditEvent
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []auditEvent
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+		mu.Lock()
+		received = append(received, batch...)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	a, err := newAuditor(filepath.Join(t.TempDir(), "audit.log"), hook.URL+"/events?token=s3cret")
+	require.NoError(t, err)
+	for _, pod := range []string{"web-1", "web-2", "web-3"} {
+		a.record(auditEvent{Pod: pod, Status: http.StatusOK})
+	}
+	a.close(5 * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 3)
+	assert.Equal(t, "web-3", received[2].Pod)
+
+	_, err = newAuditor("", "ftp://example.com")
+	assert.Error(t, err)
+}
+
+// TestRedactURL tests that credentials are taken out of logged paths
+func TestRedactURL(t *testing.T) {
+	cases := map[string]string{
+		"/api/logs/web-1/app":                            "/api/logs/web-1/app",
+		"/api/logs/web-1/app?key=s3cret&lines=10":        "/api/logs/web-1/app?key=REDACTED&lines=10",
+		"/ws/logs?selector=app%3Dweb&token=abc&ticket=":  "/ws/logs?selector=app%3Dweb&token=REDACTED&ticket=REDACTED",
+		"https://hooks.example.com/audit?access_token=x": "https://hooks.example.com/audit?access_token=REDACTED",
+		"/login/callback?code=c0de&state=st4te":          "/login/callback?code=REDACTED&state=REDACTED",
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, redactURL(in), in)
+	}
+
+	line := accessLogFormatter(gin.LogFormatterParams{TimeStamp: time.Now(), Method: "GET", Path: "/api/logs/web-1/app?key=s3cret"})
+	assert.NotContains(t, line, "s3cret")
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// config is the server configuration. It is assembled from defaults, then
+// the YAML config file, then environment variables, then command-line
+// flags, each overriding the one before.
+type config struct {
+	// Listen is the address the HTTP server listens on.
+	Listen string `json:"listen"`
+	// Namespace overrides the default namespace, which is otherwise the
+	// pod's own namespace in cluster or the kubeconfig namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// Namespaces are served besides the default one; "*" serves all.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Kubeconfig and Context select a kubeconfig file and context instead
+	// of the in-cluster config.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+	// DefaultTailLines is the number of lines returned when a request
+	// doesn't ask for a number or a time window. MaxTailLines caps what
+	// a request may ask for; 0 means no cap.
+	DefaultTailLines int64 `json:"defaultTailLines"`
+	MaxTailLines     int64 `json:"maxTailLines"`
+	Debug            bool  `json:"debug"`
+	// ShutdownGracePeriodSeconds is how long open streams get to close on
+	// SIGTERM before the server exits. Keep it below the pod's
+	// terminationGracePeriodSeconds, 30 by default.
+	ShutdownGracePeriodSeconds int64 `json:"shutdownGracePeriodSeconds"`
+
+	Auth  authConfig  `json:"auth"`
+	TLS   tlsConfig   `json:"tls"`
+	Audit auditConfig `json:"audit"`
+	// AllowedOrigins are the browser origins allowed to open WebSockets,
+	// or "*" for any. Empty allows only pages served by this host.
+	AllowedOrigins []string       `json:"allowedOrigins,omitempty"`
+	Features       featuresConfig `json:"features"`
+}
+
+type authConfig struct {
+	// LogKey, when set, must be passed as ?key= or X-API-Key.
+	LogKey string `json:"logKey,omitempty"`
+	// KeyFile is a YAML file of named API keys with their own expiry,
+	// scope and permission. It is reloaded when it changes.
+	KeyFile string     `json:"keyFile,omitempty"`
+	OIDC    oidcConfig `json:"oidc"`
+	// KubernetesRBAC accepts Kubernetes bearer tokens, checked with a
+	// TokenReview, and only serves those callers the logs RBAC lets them
+	// get. Needs the system:auth-delegator ClusterRole.
+	KubernetesRBAC bool `json:"kubernetesRBAC"`
+}
+
+// oidcConfig enables sign-in with an OpenID Connect provider when
+// IssuerURL is set.
+type oidcConfig struct {
+	IssuerURL    string `json:"issuerURL,omitempty"`
+	ClientID     string `json:"clientID,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	// RedirectURL is this server's /login/callback as the browser
+	// reaches it, e.g. https://logs.example.com/login/callback. It must
+	// be registered with the provider.
+	RedirectURL string   `json:"redirectURL,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+	// SessionSecret signs the session cookie. Set it when running more
+	// than one replica or to keep sessions across restarts; otherwise a
+	// random one is used.
+	SessionSecret        string `json:"sessionSecret,omitempty"`
+	SessionMaxAgeSeconds int64  `json:"sessionMaxAgeSeconds"`
+}
+
+// enabled reports whether OIDC sign-in is configured.
+func (c oidcConfig) enabled() bool {
+	return c.IssuerURL != ""
+}
+
+type tlsConfig struct {
+	// CertFile and KeyFile enable HTTPS when both are set. They are
+	// reloaded when they change.
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// ClientCAFile is a PEM bundle of CAs that sign client certificates.
+	// Setting it enables mutual TLS.
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+	// ClientAuth is "require" to reject clients without a certificate,
+	// or "optional" to verify one only if presented, e.g. so kubelet
+	// probes still get through.
+	ClientAuth string `json:"clientAuth,omitempty"`
+}
+
+// auditConfig records who reads which logs. Events are JSON lines with
+// the caller, source IP, endpoint, pod, options and bytes served.
+type auditConfig struct {
+	// Log is "stdout" or a file to append events to; empty disables the
+	// audit log unless WebhookURL is set, which then logs to stdout too.
+	Log string `json:"log,omitempty"`
+	// WebhookURL, when set, receives events as JSON arrays by POST.
+	WebhookURL string `json:"webhookURL,omitempty"`
+}
+
+// enabled reports whether audit events are recorded.
+func (c auditConfig) enabled() bool {
+	return c.Log != "" || c.WebhookURL != ""
+}
+
+// featuresConfig switches optional endpoints on and off.
+type featuresConfig struct {
+	// UI serves the web interface on /.
+	UI bool `json:"ui"`
+	// Downloads serves the log download and bundle endpoints.
+	Downloads bool `json:"downloads"`
+	// Aggregate serves the label selector stream on /ws/logs.
+	Aggregate bool `json:"aggregate"`
+	// LegacyLogs serves the plain text /logs endpoint.
+	LegacyLogs bool `json:"legacyLogs"`
+	// Metrics serves Prometheus metrics on /metrics.
+	Metrics bool `json:"metrics"`
+	// MetricsPodLabels labels the relayed bytes and lines metrics by pod
+	// as well as namespace. Off by default, as /metrics is open and every
+	// pod that comes and goes adds series.
+	MetricsPodLabels bool `json:"metricsPodLabels"`
+}
+
+func defaultConfig() config {
+	return config{
+		Listen:                     ":8080",
+		DefaultTailLines:           100,
+		ShutdownGracePeriodSeconds: 25,
+		Auth: authConfig{
+			OIDC: oidcConfig{
+				Scopes:               []string{"openid", "profile", "email"},
+				SessionMaxAgeSeconds: 8 * 60 * 60,
+			},
+		},
+		TLS: tlsConfig{ClientAuth: clientAuthRequire},
+		Features: featuresConfig{
+			UI:         true,
+			Downloads:  true,
+			Aggregate:  true,
+			LegacyLogs: true,
+			Metrics:    true,
+		},
+	}
+}
+
+// redactedValue replaces secrets in --print-config output.
+const redactedValue = "REDACTED"
+
+// redacted returns a copy of c safe to print.
+func (c config) redacted() config {
+	for _, secret := range []*string{&c.Auth.LogKey, &c.Auth.OIDC.ClientSecret, &c.Auth.OIDC.SessionSecret} {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+	// Webhooks often take a token in the query string
+	c.Audit.WebhookURL = redactURL(c.Audit.WebhookURL)
+	return c
+}
+
+// configOption ties a config field to its command-line flag and
+// environment variable.
+type configOption struct {
+	flag  string
+	env   string
+	usage string
+	field func(c *config) interface{}
+	// anyValue treats any non-empty environment value as true, as DEBUG
+	// always has.
+	anyValue bool
+}
+
+var configOptions = []configOption{
+	{flag: "listen", env: "LISTEN_ADDR", usage: "address to listen on", field: func(c *config) interface{} { return &c.Listen }},
+	{flag: "namespace", env: "NAMESPACE", usage: "default namespace, instead of the pod or kubeconfig namespace", field: func(c *config) interface{} { return &c.Namespace }},
+	{flag: "namespaces", env: "NAMESPACES", usage: "comma separated additional namespaces to serve, or * for all", field: func(c *config) interface{} { return &c.Namespaces }},
+	{flag: "kubeconfig", env: "KUBECONFIG", usage: "kubeconfig file to use instead of the in-cluster config", field: func(c *config) interface{} { return &c.Kubeconfig }},
+	{flag: "context", env: "KUBE_CONTEXT", usage: "kubeconfig context to use", field: func(c *config) interface{} { return &c.Context }},
+	{flag: "default-tail-lines", env: "DEFAULT_TAIL_LINES", usage: "lines returned when a request gives neither lines nor a since parameter", field: func(c *config) interface{} { return &c.DefaultTailLines }},
+	{flag: "max-tail-lines", env: "MAX_TAIL_LINES", usage: "maximum lines a request may ask for, 0 for no limit", field: func(c *config) interface{} { return &c.MaxTailLines }},
+	{flag: "shutdown-grace-period", env: "SHUTDOWN_GRACE_PERIOD", usage: "seconds open streams get to close on shutdown", field: func(c *config) interface{} { return &c.ShutdownGracePeriodSeconds }},
+	{flag: "debug", env: "DEBUG", usage: "enable gin debug mode", field: func(c *config) interface{} { return &c.Debug }, anyValue: true},
+	{flag: "log-key", env: "LOGKEY", usage: "API key required on requests", field: func(c *config) interface{} { return &c.Auth.LogKey }},
+	{flag: "key-file", env: "KEY_FILE", usage: "YAML file of named, scoped API keys", field: func(c *config) interface{} { return &c.Auth.KeyFile }},
+	{flag: "kubernetes-rbac", env: "KUBERNETES_RBAC", usage: "accept Kubernetes bearer tokens and authorize log access with RBAC", field: func(c *config) interface{} { return &c.Auth.KubernetesRBAC }},
+	{flag: "oidc-issuer-url", env: "OIDC_ISSUER_URL", usage: "OpenID Connect issuer, enables sign-in", field: func(c *config) interface{} { return &c.Auth.OIDC.IssuerURL }},
+	{flag: "oidc-client-id", env: "OIDC_CLIENT_ID", usage: "OpenID Connect client ID", field: func(c *config) interface{} { return &c.Auth.OIDC.ClientID }},
+	{flag: "oidc-client-secret", env: "OIDC_CLIENT_SECRET", usage: "OpenID Connect client secret", field: func(c *config) interface{} { return &c.Auth.OIDC.ClientSecret }},
+	{flag: "oidc-redirect-url", env: "OIDC_REDIRECT_URL", usage: "external URL of /login/callback", field: func(c *config) interface{} { return &c.Auth.OIDC.RedirectURL }},
+	{flag: "oidc-scopes", env: "OIDC_SCOPES", usage: "comma separated scopes to request", field: func(c *config) interface{} { return &c.Auth.OIDC.Scopes }},
+	{flag: "oidc-session-secret", env: "OIDC_SESSION_SECRET", usage: "secret signing session cookies, random if unset", field: func(c *config) interface{} { return &c.Auth.OIDC.SessionSecret }},
+	{flag: "oidc-session-max-age", env: "OIDC_SESSION_MAX_AGE", usage: "seconds a sign-in lasts", field: func(c *config) interface{} { return &c.Auth.OIDC.SessionMaxAgeSeconds }},
+	{flag: "audit-log", env: "AUDIT_LOG", usage: "stdout or a file to write the JSON audit log to", field: func(c *config) interface{} { return &c.Audit.Log }},
+	{flag: "audit-webhook-url", env: "AUDIT_WEBHOOK_URL", usage: "URL to POST audit events to", field: func(c *config) interface{} { return &c.Audit.WebhookURL }},
+	{flag: "tls-cert-file", env: "TLS_CERT_FILE", usage: "TLS certificate file, enables HTTPS with --tls-key-file", field: func(c *config) interface{} { return &c.TLS.CertFile }},
+	{flag: "tls-key-file", env: "TLS_KEY_FILE", usage: "TLS private key file", field: func(c *config) interface{} { return &c.TLS.KeyFile }},
+	{flag: "tls-client-ca-file", env: "TLS_CLIENT_CA_FILE", usage: "CA bundle for verifying client certificates, enables mutual TLS", field: func(c *config) interface{} { return &c.TLS.ClientCAFile }},
+	{flag: "tls-client-auth", env: "TLS_CLIENT_AUTH", usage: "require or optional client certificates with --tls-client-ca-file", field: func(c *config) interface{} { return &c.TLS.ClientAuth }},
+	{flag: "allowed-origins", env: "ALLOWED_ORIGINS", usage: "comma separated origins allowed to open WebSockets", field: func(c *config) interface{} { return &c.AllowedOrigins }},
+	{flag: "enable-ui", env: "ENABLE_UI", usage: "serve the web UI", field: func(c *config) interface{} { return &c.Features.UI }},
+	{flag: "enable-downloads", env: "ENABLE_DOWNLOADS", usage: "serve log downloads and bundles", field: func(c *config) interface{} { return &c.Features.Downloads }},
+	{flag: "enable-aggregate", env: "ENABLE_AGGREGATE", usage: "serve the label selector stream", field: func(c *config) interface{} { return &c.Features.Aggregate }},
+	{flag: "enable-legacy-logs", env: "ENABLE_LEGACY_LOGS", usage: "serve the plain text /logs endpoint", field: func(c *config) interface{} { return &c.Features.LegacyLogs }},
+	{flag: "enable-metrics", env: "ENABLE_METRICS", usage: "serve Prometheus metrics on /metrics", field: func(c *config) interface{} { return &c.Features.Metrics }},
+	{flag: "enable-metrics-pod-labels", env: "ENABLE_METRICS_POD_LABELS", usage: "label the relayed log metrics by pod too", field: func(c *config) interface{} { return &c.Features.MetricsPodLabels }},
+}
+
+// set parses value into the field the option points at.
+func (o configOption) set(c *config, value string) error {
+	switch field := o.field(c).(type) {
+	case *string:
+		*field = value
+	case *[]string:
+		*field = nil
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				*field = append(*field, v)
+			}
+		}
+	case *int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+		*field = n
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		*field = b
+	}
+	return nil
+}
+
+func (o configOption) isBool() bool {
+	_, ok := o.field(&config{}).(*bool)
+	return ok
+}
+
+// optionFlag records a flag's value so it can be applied after the config
+// file and environment.
+type optionFlag struct {
+	isBoolFlag bool
+	value      *string
+}
+
+func (f optionFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return *f.value
+}
+
+func (f optionFlag) Set(v string) error {
+	*f.value = v
+	return nil
+}
+
+func (f optionFlag) IsBoolFlag() bool { return f.isBoolFlag }
+
+// loadConfig builds the configuration from args (without the program name)
+// and the environment as returned by lookupEnv. The config file is named by
+// --config or CONFIG_FILE. printConfig is set when --print-config was given.
+func loadConfig(args []string, lookupEnv func(string) (string, bool), output io.Writer) (cfg config, printConfig bool, err error) {
+	fs := flag.NewFlagSet("k8s-simple-logs", flag.ContinueOnError)
+	fs.SetOutput(output)
+	configFile := fs.String("config", "", "YAML config file (also CONFIG_FILE)")
+	fs.BoolVar(&printConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+	flagValues := map[string]*string{}
+	for _, opt := range configOptions {
+		value := new(string)
+		flagValues[opt.flag] = value
+		fs.Var(optionFlag{isBoolFlag: opt.isBool(), value: value}, opt.flag, opt.usage+" ("+opt.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return config{}, false, err
+	}
+	if fs.NArg() > 0 {
+		return config{}, false, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	cfg = defaultConfig()
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return config{}, false, fmt.Errorf("reading config file: %v", err)
+		}
+		if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+			return config{}, false, fmt.Errorf("parsing config file %s: %v", path, err)
+		}
+	}
+
+	for _, opt := range configOptions {
+		value, ok := lookupEnv(opt.env)
+		if !ok || value == "" {
+			continue
+		}
+		if opt.anyValue {
+			if _, err := strconv.ParseBool(value); err != nil {
+				value = "true"
+			}
+		}
+		if err := opt.set(&cfg, value); err != nil {
+			return config{}, false, fmt.Errorf("invalid %s environment variable %q: %v", opt.env, value, err)
+		}
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, opt := range configOptions {
+		if !set[opt.flag] {
+			continue
+		}
+		if err := opt.set(&cfg, *flagValues[opt.flag]); err != nil {
+			return config{}, false, fmt.Errorf("invalid --%s flag %q: %v", opt.flag, *flagValues[opt.flag], err)
+		}
+	}
+
+	if cfg.MaxTailLines > 0 && cfg.DefaultTailLines > cfg.MaxTailLines {
+		return config{}, false, fmt.Errorf("defaultTailLines (%d) is larger than maxTailLines (%d)", cfg.DefaultTailLines, cfg.MaxTailLines)
+	}
+	if cfg.Auth.OIDC.enabled() && (cfg.Auth.OIDC.ClientID == "" || cfg.Auth.OIDC.RedirectURL == "") {
+		return config{}, false, fmt.Errorf("auth.oidc.issuerURL needs auth.oidc.clientID and auth.oidc.redirectURL")
+	}
+	if cfg.Auth.OIDC.enabled() && cfg.Auth.OIDC.SessionMaxAgeSeconds == 0 {
+		return config{}, false, fmt.Errorf("auth.oidc.sessionMaxAgeSeconds must be positive")
+	}
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		return config{}, false, fmt.Errorf("tls.certFile and tls.keyFile must be set together")
+	}
+	if cfg.TLS.ClientCAFile != "" && cfg.TLS.CertFile == "" {
+		return config{}, false, fmt.Errorf("tls.clientCAFile needs tls.certFile and tls.keyFile")
+	}
+	if cfg.TLS.ClientAuth != clientAuthRequire && cfg.TLS.ClientAuth != clientAuthOptional {
+		return config{}, false, fmt.Errorf("tls.clientAuth must be %q or %q, not %q", clientAuthRequire, clientAuthOptional, cfg.TLS.ClientAuth)
+	}
+	return cfg, printConfig, nil
+}
+
+// writeConfig prints cfg as YAML with secrets redacted.
+func writeConfig(w io.Writer, cfg config) error {
+	out, err := yaml.Marshal(cfg.redacted())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEnv(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func writeTestConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// TestLoadConfigDefaults tests the configuration with no file, environment or flags
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, printConfig, err := loadConfig(nil, testEnv(nil), io.Discard)
+	require.NoError(t, err)
+
+	assert.False(t, printConfig)
+	assert.Equal(t, defaultConfig(), cfg)
+	assert.Equal(t, ":8080", cfg.Listen)
+	assert.True(t, cfg.Features.UI)
+}
+
+// TestLoadConfigPrecedence tests that flags override the environment, which overrides the file
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeTestConfig(t, `
+listen: ":9000"
+namespace: from-file
+namespaces: [team-a, team-b]
+defaultTailLines: 50
+auth:
+  logKey: file-key
+features:
+  ui: false
+`)
+	env := testEnv(map[string]string{
+		"CONFIG_FILE": path,
+		"NAMESPACE":   "from-env",
+		"LOGKEY":      "env-key",
+		"DEBUG":       "yes",
+	})
+	cfg, _, err := loadConfig([]string{"--namespace=from-flag", "--enable-ui", "--max-tail-lines", "1000"}, env, io.Discard)
+	require.NoError(t, err)
+
+	assert.Equal(t, ":9000", cfg.Listen)
+	assert.Equal(t, "from-flag", cfg.Namespace)
+	assert.Equal(t, []string{"team-a", "team-b"}, cfg.Namespaces)
+	assert.Equal(t, int64(50), cfg.DefaultTailLines)
+	assert.Equal(t, int64(1000), cfg.MaxTailLines)
+	assert.Equal(t, "env-key", cfg.Auth.LogKey)
+	assert.True(t, cfg.Debug, "DEBUG has always been enabled by any value")
+	assert.True(t, cfg.Features.UI)
+}
+
+// TestLoadConfigErrors tests that bad files, values and combinations are rejected
+func TestLoadConfigErrors(t *testing.T) {
+	cases := []struct {
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{[]string{"--config", writeTestConfig(t, "listn: :80\n")}, nil, "unknown field"},
+		{[]string{"--config", "/does/not/exist.yaml"}, nil, "reading config file"},
+		{nil, map[string]string{"MAX_TAIL_LINES": "lots"}, "invalid MAX_TAIL_LINES environment variable"},
+		{[]string{"--enable-ui=maybe"}, nil, "invalid --enable-ui flag"},
+		{[]string{"--default-tail-lines=500", "--max-tail-lines=100"}, nil, "larger than maxTailLines"},
+		{[]string{"--oidc-issuer-url=https://idp.example.com"}, nil, "needs auth.oidc.clientID"},
+		{[]string{"--tls-cert-file=cert.pem"}, nil, "must be set together"},
+		{[]string{"--tls-client-ca-file=ca.pem"}, nil, "needs tls.certFile"},
+		{[]string{"--tls-client-auth=sometimes"}, nil, "tls.clientAuth must be"},
+		{[]string{"extra"}, nil, "unexpected argument"},
+	}
+	for _, tc := range cases {
+		_, _, err := loadConfig(tc.args, testEnv(tc.env), io.Discard)
+		if assert.Error(t, err, "%v %v", tc.args, tc.env) {
+			assert.Contains(t, err.Error(), tc.want)
+		}
+	}
+}
+
+// TestPrintConfigRedactsSecrets tests that --print-config never shows the API key
+func TestPrintConfigRedactsSecrets(t *testing.T) {
+	cfg, printConfig, err := loadConfig([]string{"--print-config", "--log-key=hunter2"}, testEnv(map[string]string{"OIDC_CLIENT_SECRET": "swordfish"}), io.Discard)
+	require.NoError(t, err)
+	require.True(t, printConfig)
+
+	var out bytes.Buffer
+	require.NoError(t, writeConfig(&out, cfg))
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.NotContains(t, out.String(), "swordfish")
+	assert.Contains(t, out.String(), "logKey: "+redactedValue)
+	assert.Contains(t, out.String(), "listen: :8080")
+	assert.Equal(t, "hunter2", cfg.Auth.LogKey, "redaction must not change the config in use")
+}
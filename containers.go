@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Container types reported in PodContainer.Type.
+const (
+	containerTypeRegular   = "regular"
+	containerTypeInit      = "init"
+	containerTypeSidecar   = "sidecar"
+	containerTypeEphemeral = "ephemeral"
+)
+
+type PodContainer struct {
+	PodName       string `json:"podName"`
+	ContainerName string `json:"containerName"`
+	Namespace     string `json:"namespace"`
+	ID            string `json:"id"`
+	// Type is one of regular, init, sidecar (an init container with
+	// restartPolicy Always) or ephemeral.
+	Type string `json:"type"`
+	// State is waiting, running or terminated, or empty if the kubelet
+	// hasn't reported a status yet. Reason and ExitCode explain it.
+	State        string `json:"state"`
+	Reason       string `json:"reason,omitempty"`
+	ExitCode     *int32 `json:"exitCode,omitempty"`
+	RestartCount int32  `json:"restartCount"`
+	Ready        bool   `json:"ready"`
+	Image        string `json:"image"`
+	NodeName     string `json:"nodeName"`
+	PodPhase     string `json:"podPhase"`
+}
+
+// podContainers returns the sidebar entries for every container of pod:
+// init and sidecar containers first, then regular, then ephemeral ones.
+func podContainers(pod *corev1.Pod) []PodContainer {
+	statuses := map[string]corev1.ContainerStatus{}
+	for _, list := range [][]corev1.ContainerStatus{
+		pod.Status.InitContainerStatuses,
+		pod.Status.ContainerStatuses,
+		pod.Status.EphemeralContainerStatuses,
+	} {
+		for _, status := range list {
+			statuses[status.Name] = status
+		}
+	}
+
+	containers := []PodContainer{}
+	add := func(name, image, containerType string) {
+		container := PodContainer{
+			PodName:       pod.Name,
+			ContainerName: name,
+			Namespace:     pod.Namespace,
+			ID:            fmt.Sprintf("%s/%s", pod.Name, name),
+			Type:          containerType,
+			Image:         image,
+			NodeName:      pod.Spec.NodeName,
+			PodPhase:      string(pod.Status.Phase),
+		}
+		if status, ok := statuses[name]; ok {
+			container.RestartCount = status.RestartCount
+			container.Ready = status.Ready
+			switch {
+			case status.State.Running != nil:
+				container.State = "running"
+			case status.State.Waiting != nil:
+				container.State = "waiting"
+				container.Reason = status.State.Waiting.Reason
+			case status.State.Terminated != nil:
+				container.State = "terminated"
+				container.Reason = status.State.Terminated.Reason
+				exitCode := status.State.Terminated.ExitCode
+				container.ExitCode = &exitCode
+			}
+		}
+		containers = append(containers, container)
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		containerType := containerTypeInit
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			containerType = containerTypeSidecar
+		}
+		add(container.Name, container.Image, containerType)
+	}
+	for _, container := range pod.Spec.Containers {
+		add(container.Name, container.Image, containerTypeRegular)
+	}
+	for _, container := range pod.Spec.EphemeralContainers {
+		add(container.Name, container.Image, containerTypeEphemeral)
+	}
+	return containers
+}
+
+// containerWatchHandler serves /api/containers/watch, a WebSocket that
+// pushes a message for every pod added, updated or deleted in the cache so
+// the UI sidebar stays current without polling. Each message carries the
+// pod's full container list:
+//
+//	{"type":"added|updated|deleted","pod":"...","containers":[...]}
+func containerWatchHandler(namespaces *namespaceRegistry, upgrader *websocket.Upgrader, drainer *drainer, kubeAuth *kubeAuthorizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		namespace := c.GetString("namespace")
+		pods := namespaces.cache(namespace)
+		if err := pods.waitForSync(c.Request.Context()); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		// Only report pods whose logs the caller may read
+		visible := visiblePods(c, kubeAuth, namespace)
+
+		conn, ok := upgradeSession(c, upgrader, drainer)
+		if !ok {
+			return
+		}
+		defer conn.Close()
+
+		// Event handlers run one at a time for this registration, so writes
+		// to the connection never overlap.
+		send := func(eventType string, pod *corev1.Pod) {
+			if !visible(pod.Name) {
+				return
+			}
+			containers := podContainers(pod)
+			if eventType == "deleted" {
+				containers = []PodContainer{}
+			}
+			if err := conn.WriteJSON(gin.H{
+				"type":       eventType,
+				"pod":        pod.Name,
+				"containers": containers,
+			}); err != nil {
+				conn.cancel()
+			}
+		}
+
+		unsubscribe, err := pods.subscribe(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if pod, ok := obj.(*corev1.Pod); ok {
+					send("added", pod)
+				}
+			},
+			UpdateFunc: func(_, obj interface{}) {
+				if pod, ok := obj.(*corev1.Pod); ok {
+					send("updated", pod)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if pod, ok := podFromDeleteEvent(obj); ok {
+					send("deleted", pod)
+				}
+			},
+		})
+		if err != nil {
+			conn.WriteJSON(gin.H{"error": err.Error()})
+			return
+		}
+		defer unsubscribe()
+
+		<-conn.ctx.Done()
+	}
+}
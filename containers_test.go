@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestPodContainersTypesAndStatus tests that every container kind is listed with its status
+func TestPodContainersTypesAndStatus(t *testing.T) {
+	always := corev1.ContainerRestartPolicyAlways
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop"},
+		Spec: corev1.PodSpec{
+			NodeName: "node-a",
+			InitContainers: []corev1.Container{
+				{Name: "migrate", Image: "migrate:1"},
+				{Name: "proxy", Image: "envoy:1", RestartPolicy: &always},
+			},
+			Containers: []corev1.Container{{Name: "app", Image: "app:2"}},
+			EphemeralContainers: []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", Image: "busybox"}},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{Name: "migrate", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Completed"}}},
+				{Name: "proxy", Ready: true, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", RestartCount: 4, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+			},
+		},
+	}
+
+	containers := podContainers(pod)
+	require.Len(t, containers, 4)
+
+	assert.Equal(t, "migrate", containers[0].ContainerName)
+	assert.Equal(t, containerTypeInit, containers[0].Type)
+	assert.Equal(t, "terminated", containers[0].State)
+	assert.Equal(t, "Completed", containers[0].Reason)
+	require.NotNil(t, containers[0].ExitCode)
+	assert.Equal(t, int32(0), *containers[0].ExitCode)
+
+	assert.Equal(t, containerTypeSidecar, containers[1].Type)
+	assert.Equal(t, "running", containers[1].State)
+	assert.True(t, containers[1].Ready)
+
+	assert.Equal(t, "web-1/app", containers[2].ID)
+	assert.Equal(t, containerTypeRegular, containers[2].Type)
+	assert.Equal(t, "waiting", containers[2].State)
+	assert.Equal(t, "CrashLoopBackOff", containers[2].Reason)
+	assert.Equal(t, int32(4), containers[2].RestartCount)
+	assert.Equal(t, "app:2", containers[2].Image)
+	assert.Equal(t, "node-a", containers[2].NodeName)
+	assert.Equal(t, "Running", containers[2].PodPhase)
+	assert.Equal(t, "shop", containers[2].Namespace)
+
+	// No status reported yet
+	assert.Equal(t, containerTypeEphemeral, containers[3].Type)
+	assert.Equal(t, "", containers[3].State)
+}
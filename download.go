@@ -0,0 +1,320 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Formats accepted by the download endpoint's format parameter.
+const (
+	downloadFormatText   = "text"
+	downloadFormatNDJSON = "ndjson"
+	downloadFormatGzip   = "gzip"
+)
+
+// logDownloadHandler serves a container's logs as a file attachment, as
+// plain text, newline delimited JSON or gzipped text. Unlike the JSON logs
+// endpoint the whole log is returned unless lines, a since* parameter or
+// the configured maximum narrows it, and the body is streamed rather than
+// built in memory.
+func logDownloadHandler(clientset kubernetes.Interface, limits tailLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		namespace := c.GetString("namespace")
+		podName := c.Param("pod")
+		containerName := c.Param("container")
+
+		format := c.DefaultQuery("format", downloadFormatText)
+		var contentType, extension string
+		switch format {
+		case downloadFormatText:
+			contentType, extension = "text/plain; charset=utf-8", ".log"
+		case downloadFormatNDJSON:
+			contentType, extension = "application/x-ndjson", ".ndjson"
+		case downloadFormatGzip:
+			contentType, extension = "application/gzip", ".log.gz"
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid format parameter %q: must be text, ndjson or gzip", format)})
+			return
+		}
+
+		podLogOpts, err := logOptionsFromQuery(c, containerName, limits.withDefault(0))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter, err := lineFilterFromQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		keepTimestamps := podLogOpts.Timestamps
+		if format == downloadFormatNDJSON {
+			podLogOpts.Timestamps = true
+		}
+
+		logStream, err := openLogStream(c.Request.Context(), clientset.CoreV1().Pods(namespace).GetLogs(podName, podLogOpts))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer logStream.Close()
+
+		filename := podName + "_" + containerName
+		if podLogOpts.Previous {
+			filename += "_previous"
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+extension))
+		c.Status(http.StatusOK)
+
+		// Headers are sent by now, so a failure part way through can only
+		// cut the download short.
+		switch format {
+		case downloadFormatText:
+			err = copyFiltered(c.Writer, logStream, filter)
+		case downloadFormatGzip:
+			gz := gzip.NewWriter(c.Writer)
+			err = copyFiltered(gz, logStream, filter)
+			if closeErr := gz.Close(); err == nil {
+				err = closeErr
+			}
+		case downloadFormatNDJSON:
+			err = writeNDJSON(c.Writer, logStream, filter, podName, containerName, keepTimestamps)
+		}
+		if err != nil {
+			fmt.Printf("download of %s/%s/%s failed: %v\n", namespace, podName, containerName, err)
+		}
+	}
+}
+
+// writeNDJSON writes one JSON object per selected line, shaped like the
+// WebSocket messages. r must carry kubelet timestamps.
+func writeNDJSON(w io.Writer, r io.Reader, filter *lineFilter, podName, containerName string, keepTimestamps bool) error {
+	enc := json.NewEncoder(w)
+	var encodeErr error
+	err := followLogs(r, filter, keepTimestamps, nil, func(_ string, msg gin.H) error {
+		msg["pod"] = podName
+		msg["container"] = containerName
+		encodeErr = enc.Encode(msg)
+		return encodeErr
+	})
+	if encodeErr != nil {
+		return encodeErr
+	}
+	return err
+}
+
+// bundleHandler streams a zip archive for attaching to incident tickets. For
+// every pod in the namespace, or those matching the optional selector, it
+// holds the pod manifest, the pod's events and the current and previous
+// logs of each container:
+//
+//	<pod>/pod.yaml
+//	<pod>/events.yaml
+//	<pod>/<container>.log
+//	<pod>/<container>.previous.log
+//
+// A log that can't be fetched is replaced by a <name>.error file holding the
+// reason, and a log cut short gets one beside what was read, so one broken
+// container doesn't spoil the bundle. So are manifests and events a caller
+// with a Kubernetes token may not read: access to the route only checks
+// pods/log, while manifests can hold secrets in their env. Logs are capped
+// at limits.maxLines like other downloads.
+func bundleHandler(clientset kubernetes.Interface, namespaces *namespaceRegistry, kubeAuth *kubeAuthorizer, limits tailLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		namespace := c.GetString("namespace")
+
+		selector := labels.Everything()
+		if v := c.Query("selector"); v != "" {
+			parsed, err := labels.Parse(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid selector parameter %q: %v", v, err)})
+				return
+			}
+			selector = parsed
+		}
+
+		pods := namespaces.cache(namespace)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cacheSyncTimeout)
+		err := pods.waitForSync(ctx)
+		cancel()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		podList, err := pods.list(selector)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var access bundleAccess
+		if access.manifests, err = kubeAuth.allowed(c, namespace, "get", "pods"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if access.events, err = kubeAuth.allowed(c, namespace, "list", "events"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		filename := fmt.Sprintf("%s-logs-%s.zip", namespace, time.Now().UTC().Format("20060102T150405Z"))
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Status(http.StatusOK)
+
+		zw := zip.NewWriter(c.Writer)
+		for _, pod := range podList {
+			if err := writePodBundle(c.Request.Context(), zw, clientset, pod, access, limits); err != nil {
+				fmt.Printf("bundle for %s/%s failed: %v\n", namespace, pod.Name, err)
+				break
+			}
+		}
+		if err := zw.Close(); err != nil {
+			fmt.Printf("bundle for %s failed: %v\n", namespace, err)
+		}
+	}
+}
+
+// bundleAccess says what a bundle may hold besides logs.
+type bundleAccess struct {
+	// manifests is set if the caller may get pods
+	manifests bool
+	// events is set if the caller may list events
+	events bool
+}
+
+// writePodBundle adds one pod's manifest, events and logs to zw, as far as
+// access allows, each log cut to the last limits.maxLines lines if set. Only
+// errors writing the archive itself are returned.
+func writePodBundle(ctx context.Context, zw *zip.Writer, clientset kubernetes.Interface, pod *corev1.Pod, access bundleAccess, limits tailLimits) error {
+	dir := pod.Name + "/"
+
+	if access.manifests {
+		manifest := pod.DeepCopy()
+		manifest.APIVersion = "v1"
+		manifest.Kind = "Pod"
+		manifest.ManagedFields = nil
+		if err := writeBundleYAML(zw, dir+"pod.yaml", manifest); err != nil {
+			return err
+		}
+	} else if err := writeBundleError(zw, dir+"pod.yaml", fmt.Errorf("left out: the caller may not get pods in namespace %s", pod.Namespace)); err != nil {
+		return err
+	}
+
+	if access.events {
+		if err := writePodEvents(ctx, zw, clientset, pod, dir+"events.yaml"); err != nil {
+			return err
+		}
+	} else if err := writeBundleError(zw, dir+"events.yaml", fmt.Errorf("left out: the caller may not list events in namespace %s", pod.Namespace)); err != nil {
+		return err
+	}
+
+	for _, container := range podContainers(pod) {
+		if err := writeBundleLog(ctx, zw, clientset, pod, container.ContainerName, false, limits, dir+container.ContainerName+".log"); err != nil {
+			return err
+		}
+		if container.RestartCount > 0 {
+			if err := writeBundleLog(ctx, zw, clientset, pod, container.ContainerName, true, limits, dir+container.ContainerName+".previous.log"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writePodEvents(ctx context.Context, zw *zip.Writer, clientset kubernetes.Interface, pod *corev1.Pod, name string) error {
+	events, err := clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.name", pod.Name).String(),
+	})
+	if err != nil {
+		return writeBundleError(zw, name, err)
+	}
+	events.APIVersion = "v1"
+	events.Kind = "EventList"
+	return writeBundleYAML(zw, name, events)
+}
+
+func writeBundleLog(ctx context.Context, zw *zip.Writer, clientset kubernetes.Interface, pod *corev1.Pod, container string, previous bool, limits tailLimits, name string) error {
+	opts := &corev1.PodLogOptions{Container: container, Previous: previous}
+	if limits.maxLines > 0 {
+		maxLines := limits.maxLines
+		opts.TailLines = &maxLines
+	}
+	logStream, err := openLogStream(ctx, clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, opts))
+	if err != nil {
+		return writeBundleError(zw, name, err)
+	}
+	defer logStream.Close()
+
+	return copyBundleLog(zw, name, logStream)
+}
+
+// copyBundleLog copies a log into the archive as name. If reading the log
+// fails part way, what was read is kept and the reason is added as a
+// <name>.error file; only errors writing the archive are returned.
+func copyBundleLog(zw *zip.Writer, name string, r io.Reader) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	archive := &errWriter{w: w}
+	if _, err := io.Copy(archive, r); err != nil {
+		if archive.err != nil {
+			return archive.err
+		}
+		return writeBundleError(zw, name, err)
+	}
+	return nil
+}
+
+// errWriter records the error of a failed Write, telling write errors
+// apart from read errors io.Copy returns.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	n, err := e.w.Write(p)
+	if err != nil {
+		e.err = err
+	}
+	return n, err
+}
+
+func writeBundleYAML(zw *zip.Writer, name string, obj interface{}) error {
+	b, err := yaml.Marshal(obj)
+	if err != nil {
+		return writeBundleError(zw, name, err)
+	}
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func writeBundleError(zw *zip.Writer, name string, cause error) error {
+	w, err := zw.Create(name + ".error")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, cause.Error()+"\n")
+	return err
+}
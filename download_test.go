@@ -0,0 +1,152 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestWriteNDJSON tests that each selected line becomes one JSON object with its timestamp split off
+func TestWriteNDJSON(t *testing.T) {
+	input := "2024-05-01T12:00:00Z hello\n2024-05-01T12:00:01Z skip me\n2024-05-01T12:00:02Z hello again\n"
+	filter := &lineFilter{grep: []string{"hello"}}
+
+	var out bytes.Buffer
+	require.NoError(t, writeNDJSON(&out, strings.NewReader(input), filter, "web-1", "app", false))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	var msg map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &msg))
+	assert.Equal(t, "2024-05-01T12:00:02Z", msg["timestamp"])
+	assert.Equal(t, "hello again", msg["log"])
+	assert.Equal(t, "web-1", msg["pod"])
+	assert.Equal(t, "app", msg["container"])
+}
+
+// TestLogDownloadFormats tests the Content-Disposition and body of each download format
+func TestLogDownloadFormats(t *testing.T) {
+	r := gin.New()
+	r.GET("/download/:pod/:container", logDownloadHandler(fake.NewSimpleClientset(), tailLimits{}))
+
+	cases := map[string]struct {
+		filename string
+		gzipped  bool
+	}{
+		"":                           {"web-1_app.log", false},
+		"?format=text&previous=true": {"web-1_app_previous.log", false},
+		"?format=gzip":               {"web-1_app.log.gz", true},
+		"?format=ndjson":             {"web-1_app.ndjson", false},
+	}
+	for query, want := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/download/web-1/app"+query, nil)
+		r.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code, query)
+		assert.Equal(t, `attachment; filename="`+want.filename+`"`, w.Header().Get("Content-Disposition"), query)
+		body := w.Body.Bytes()
+		if want.gzipped {
+			gz, err := gzip.NewReader(bytes.NewReader(body))
+			require.NoError(t, err, query)
+			body, err = io.ReadAll(gz)
+			require.NoError(t, err, query)
+		}
+		// The fake clientset always answers with "fake logs"
+		assert.Contains(t, string(body), "fake logs", query)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/download/web-1/app?format=xml", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid format parameter")
+}
+
+// TestWritePodBundle tests the files written for a pod with a restarted container
+func TestWritePodBundle(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "proxy"}}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "app", RestartCount: 2},
+			{Name: "proxy"},
+		}},
+	}
+
+	clientset := fake.NewSimpleClientset(pod)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	require.NoError(t, writePodBundle(context.Background(), zw, clientset, pod, bundleAccess{manifests: true, events: true}, tailLimits{maxLines: 5000}))
+	require.NoError(t, zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{
+		"web-1/pod.yaml",
+		"web-1/events.yaml",
+		"web-1/app.log",
+		"web-1/app.previous.log",
+		"web-1/proxy.log",
+	}, names)
+
+	f, err := zr.Open("web-1/pod.yaml")
+	require.NoError(t, err)
+	manifest, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Contains(t, string(manifest), "kind: Pod")
+
+	// Every log is capped like other downloads
+	requests := append(logRequests(clientset, "app"), logRequests(clientset, "proxy")...)
+	require.Len(t, requests, 3)
+	for _, opts := range requests {
+		require.NotNil(t, opts.TailLines, opts.Container)
+		assert.Equal(t, int64(5000), *opts.TailLines, opts.Container)
+	}
+}
+
+// TestCopyBundleLogReadError tests that a log cut short by a read error keeps what was read and gets an error file
+func TestCopyBundleLogReadError(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	log := io.MultiReader(strings.NewReader("first line\n"), iotest.ErrReader(errors.New("connection reset by peer")))
+	require.NoError(t, copyBundleLog(zw, "web-1/app.log", log))
+	require.NoError(t, copyBundleLog(zw, "web-1/proxy.log", strings.NewReader("proxy line\n")))
+	require.NoError(t, zw.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		b, err := io.ReadAll(r)
+		require.NoError(t, err)
+		files[f.Name] = string(b)
+	}
+	assert.Equal(t, map[string]string{
+		"web-1/app.log":       "first line\n",
+		"web-1/app.log.error": "connection reset by peer\n",
+		"web-1/proxy.log":     "proxy line\n",
+	}, files)
+}
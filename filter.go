@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lineFilter selects log lines server-side. A line matches when it contains
+// one of the grep substrings (if any), matches regex (if set), contains
+// none of the grepv substrings and satisfies every field filter. Before and
+// after give the number of context lines kept around each match, like grep
+// -B and -A.
+type lineFilter struct {
+	grep   []string
+	grepv  []string
+	regex  *regexp.Regexp
+	fields []fieldFilter
+	before int
+	after  int
+}
+
+// lineFilterFromQuery builds a lineFilter from the grep, grepv, regex,
+// field, before, after and context query parameters. grep, grepv and field
+// may be repeated. It returns nil when no filtering was asked for.
+func lineFilterFromQuery(c *gin.Context) (*lineFilter, error) {
+	f := &lineFilter{
+		grep:  nonEmpty(c.QueryArray("grep")),
+		grepv: nonEmpty(c.QueryArray("grepv")),
+	}
+
+	if v := c.Query("regex"); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex parameter %q: %v", v, err)
+		}
+		f.regex = re
+	}
+
+	for _, expr := range nonEmpty(c.QueryArray("field")) {
+		field, err := parseFieldFilter(expr)
+		if err != nil {
+			return nil, err
+		}
+		f.fields = append(f.fields, field)
+	}
+
+	for _, param := range []struct {
+		name   string
+		target []*int
+	}{
+		{"context", []*int{&f.before, &f.after}},
+		{"before", []*int{&f.before}},
+		{"after", []*int{&f.after}},
+	} {
+		v, ok := c.GetQuery(param.name)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s parameter %q: must be a non-negative integer", param.name, v)
+		}
+		for _, target := range param.target {
+			*target = n
+		}
+	}
+
+	if len(f.grep) == 0 && len(f.grepv) == 0 && f.regex == nil && len(f.fields) == 0 {
+		if f.before > 0 || f.after > 0 {
+			return nil, fmt.Errorf("context lines need a grep, grepv, regex or field parameter")
+		}
+		return nil, nil
+	}
+	return f, nil
+}
+
+func nonEmpty(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// matches reports whether line passes the filter on its own.
+func (f *lineFilter) matches(line string) bool {
+	for _, exclude := range f.grepv {
+		if strings.Contains(line, exclude) {
+			return false
+		}
+	}
+	if f.regex != nil && !f.regex.MatchString(line) {
+		return false
+	}
+	if len(f.fields) > 0 {
+		parsed := parseStructured(line)
+		for _, field := range f.fields {
+			if !field.matches(parsed) {
+				return false
+			}
+		}
+	}
+	if len(f.grep) == 0 {
+		return true
+	}
+	for _, include := range f.grep {
+		if strings.Contains(line, include) {
+			return true
+		}
+	}
+	return false
+}
+
+// filteredLine is a line selected by a lineSelector, with the kubelet
+// timestamp split off if there was one. Context is set for lines kept only
+// because they surround a match, and Gap when lines were dropped between
+// this line and the previous one selected.
+type filteredLine struct {
+	Timestamp string
+	Text      string
+	Context   bool
+	Gap       bool
+}
+
+// lineSelector applies a lineFilter to one stream of lines, tracking the
+// context window across calls.
+type lineSelector struct {
+	filter     *lineFilter
+	pending    []filteredLine
+	afterLeft  int
+	skipped    bool
+	anyEmitted bool
+}
+
+func newLineSelector(f *lineFilter) *lineSelector {
+	return &lineSelector{filter: f}
+}
+
+// next feeds one line and returns the lines to emit because of it: buffered
+// context lines before a match, the match itself, or a trailing context line.
+// The filter is applied to text, never to the timestamp.
+func (s *lineSelector) next(timestamp, text string) []filteredLine {
+	line := filteredLine{Timestamp: timestamp, Text: text}
+	if s.filter.matches(text) {
+		var out []filteredLine
+		gap := s.skipped && s.anyEmitted
+		for _, pending := range s.pending {
+			pending.Context = true
+			pending.Gap = gap
+			out = append(out, pending)
+			gap = false
+		}
+		line.Gap = gap
+		out = append(out, line)
+		s.pending = s.pending[:0]
+		s.afterLeft = s.filter.after
+		s.skipped = false
+		s.anyEmitted = true
+		return out
+	}
+
+	if s.afterLeft > 0 {
+		s.afterLeft--
+		line.Context = true
+		return []filteredLine{line}
+	}
+
+	if s.filter.before > 0 {
+		if len(s.pending) == s.filter.before {
+			s.pending = s.pending[1:]
+			s.skipped = true
+		}
+		s.pending = append(s.pending, line)
+		return nil
+	}
+
+	s.skipped = true
+	return nil
+}
+
+// copyFiltered copies log text from r to w, keeping only the lines selected
+// by f. Non-adjacent groups are separated by "--" when context lines are
+// requested, as grep does. f is applied to the text after any kubelet
+// timestamp, and selected lines are written as read. A nil filter copies
+// everything unchanged.
+func copyFiltered(w io.Writer, r io.Reader, f *lineFilter) error {
+	if f == nil {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	selector := newLineSelector(f)
+	withContext := f.before > 0 || f.after > 0
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		for _, line := range selector.next(splitTimestamp(scanner.Text())) {
+			if line.Gap && withContext {
+				if _, err := io.WriteString(w, "--\n"); err != nil {
+					return err
+				}
+			}
+			text := line.Text
+			if line.Timestamp != "" {
+				text = line.Timestamp + " " + text
+			}
+			if _, err := io.WriteString(w, text+"\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
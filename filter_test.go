@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLineFilterFromQueryNoFilter tests that no filter is built without filter parameters
+func TestLineFilterFromQueryNoFilter(t *testing.T) {
+	f, err := lineFilterFromQuery(testContext("/?lines=10"))
+	require.NoError(t, err)
+	assert.Nil(t, f)
+}
+
+// TestLineFilterFromQueryInvalid tests that bad filter parameters are rejected
+func TestLineFilterFromQueryInvalid(t *testing.T) {
+	cases := map[string]string{
+		"regex=%5B":         "invalid regex parameter",
+		"grep=x&context=-1": "invalid context parameter",
+		"grep=x&after=two":  "invalid after parameter",
+		"before=2":          "context lines need",
+	}
+	for query, want := range cases {
+		_, err := lineFilterFromQuery(testContext("/?" + query))
+		if assert.Error(t, err, query) {
+			assert.Contains(t, err.Error(), want, query)
+		}
+	}
+}
+
+// TestLineFilterMatches tests grep, grepv and regex combined
+func TestLineFilterMatches(t *testing.T) {
+	f, err := lineFilterFromQuery(testContext("/?grep=ERROR&grep=WARN&grepv=healthcheck&regex=user=%5Cd%2B"))
+	require.NoError(t, err)
+
+	assert.True(t, f.matches("ERROR failed for user=42"))
+	assert.True(t, f.matches("WARN slow request user=7"))
+	assert.False(t, f.matches("INFO ok user=42"))
+	assert.False(t, f.matches("ERROR healthcheck user=1"))
+	assert.False(t, f.matches("ERROR no user here"))
+}
+
+// TestCopyFilteredWithContext tests context lines and "--" separators between groups
+func TestCopyFilteredWithContext(t *testing.T) {
+	f, err := lineFilterFromQuery(testContext("/?grep=ERROR&before=1&after=1"))
+	require.NoError(t, err)
+
+	input := strings.Join([]string{"a", "b", "ERROR 1", "c", "d", "e", "ERROR 2", "ERROR 3", "f", "g"}, "\n") + "\n"
+	out := new(strings.Builder)
+	require.NoError(t, copyFiltered(out, strings.NewReader(input), f))
+
+	assert.Equal(t, "b\nERROR 1\nc\n--\ne\nERROR 2\nERROR 3\nf\n", out.String())
+}
+
+// TestCopyFilteredWithTimestamps tests that filters see the text after the kubelet timestamp and lines keep it
+func TestCopyFilteredWithTimestamps(t *testing.T) {
+	f, err := lineFilterFromQuery(testContext("/?field=level%3E%3Dwarn&regex=%5E%7B"))
+	require.NoError(t, err)
+
+	input := "2024-01-01T00:00:00.123456789Z {\"level\":\"error\"}\n" +
+		"2024-01-01T00:00:01.123456789Z {\"level\":\"info\"}\n"
+	out := new(strings.Builder)
+	require.NoError(t, copyFiltered(out, strings.NewReader(input), f))
+
+	assert.Equal(t, "2024-01-01T00:00:00.123456789Z {\"level\":\"error\"}\n", out.String())
+}
+
+// TestCopyFilteredLongLines tests that lines longer than bufio's default limit are filtered, and overlong ones fail
+func TestCopyFilteredLongLines(t *testing.T) {
+	f, err := lineFilterFromQuery(testContext("/?grep=ERROR"))
+	require.NoError(t, err)
+
+	long := "ERROR " + strings.Repeat("x", 100*1024)
+	out := new(strings.Builder)
+	require.NoError(t, copyFiltered(out, strings.NewReader(long+"\nok\n"), f))
+	assert.Equal(t, long+"\n", out.String())
+
+	tooLong := strings.Repeat("x", maxLineSize+1)
+	assert.Error(t, copyFiltered(new(strings.Builder), strings.NewReader(tooLong+"\n"), f))
+}
+
+// TestCopyFilteredWithoutFilter tests that a nil filter copies the input unchanged
+func TestCopyFilteredWithoutFilter(t *testing.T) {
+	out := new(strings.Builder)
+	require.NoError(t, copyFiltered(out, strings.NewReader("one\ntwo"), nil))
+	assert.Equal(t, "one\ntwo", out.String())
+}
+
+// TestLineSelectorMarksContext tests that context lines are flagged for streaming clients
+func TestLineSelectorMarksContext(t *testing.T) {
+	f, err := lineFilterFromQuery(testContext("/?grep=ERROR&after=1"))
+	require.NoError(t, err)
+	s := newLineSelector(f)
+
+	assert.Empty(t, s.next("", "info"))
+	assert.Equal(t, []filteredLine{{Text: "ERROR"}}, s.next("", "ERROR"))
+	assert.Equal(t, []filteredLine{{Text: "next", Context: true}}, s.next("", "next"))
+	assert.Empty(t, s.next("", "quiet"))
+	assert.Equal(t, []filteredLine{{Text: "ERROR again", Gap: true}}, s.next("", "ERROR again"))
+}
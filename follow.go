@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// resumePoint is the last line a client saw before reconnecting. The
+// stream is reopened from that second and what the client already has is
+// skipped.
+type resumePoint struct {
+	after time.Time
+	// hash, if set, is the lineHash of the last line seen, telling apart
+	// lines written in the same nanosecond. Without it every line with the
+	// timestamp counts as seen.
+	hash string
+	// matched is set once the line with hash has gone by.
+	matched bool
+	// reached is set once the last line seen, or without a hash any line up
+	// to it, has come by again. Without it, the tail cap cut off lines
+	// between the resume point and the first new line.
+	reached bool
+	// gap is set when a new line comes first, until reported by skipped.
+	gap bool
+	// done is set once a line past the resume point has been seen; later
+	// lines aren't checked.
+	done bool
+}
+
+// parseResumePoint parses "<timestamp>[,<hash>]": the RFC3339Nano timestamp
+// of the last line seen and, optionally, its hash.
+func parseResumePoint(value string) (*resumePoint, error) {
+	timestamp, hash, _ := strings.Cut(value, ",")
+	after, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resume point %q: must be an RFC3339 timestamp, optionally followed by a comma and the line hash", value)
+	}
+	return &resumePoint{after: after, hash: hash}, nil
+}
+
+// formatResumePoint returns the resume point after the line with timestamp
+// and hash, as parseResumePoint reads it.
+func formatResumePoint(timestamp, hash string) string {
+	return timestamp + "," + hash
+}
+
+// lineHash identifies a line's text, sent with each message so a client
+// can resume after it.
+func lineHash(text string) string {
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// apply makes opts read from the resume point instead of a tail. SinceTime
+// only has second precision, so the overlap is skipped by seen. The tail
+// cap still applies, so the server never replays more than it would send
+// as a tail; if more was written, skipped reports the gap.
+func (r *resumePoint) apply(opts *corev1.PodLogOptions, limits tailLimits) {
+	since := metav1.NewTime(r.after.Truncate(time.Second))
+	opts.SinceTime = &since
+	opts.SinceSeconds = nil
+	opts.TailLines = nil
+	if limits.maxLines > 0 {
+		maxLines := limits.maxLines
+		opts.TailLines = &maxLines
+	}
+}
+
+// seen reports whether the line with timestamp and text was delivered
+// before the reconnect. A nil resumePoint has seen nothing.
+func (r *resumePoint) seen(timestamp, text string) bool {
+	if r == nil || r.done || timestamp == "" {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil {
+		return false
+	}
+	switch {
+	case t.Before(r.after):
+		r.reached = r.hash == ""
+		return true
+	case t.Equal(r.after) && r.hash != "":
+		// Lines of the same instant up to the last one seen were delivered
+		if r.matched {
+			return false
+		}
+		r.matched = lineHash(text) == r.hash
+		r.reached = r.matched
+		return true
+	case t.Equal(r.after):
+		r.reached = true
+		return true
+	}
+	r.done = true
+	r.gap = !r.reached
+	return false
+}
+
+// skipped reports, once, whether lines the client never got were cut off
+// before the line seen last returned false.
+func (r *resumePoint) skipped() bool {
+	if r == nil || !r.gap {
+		return false
+	}
+	r.gap = false
+	return true
+}
+
+// followLogs relays a log stream read with timestamps line by line, as
+// the messages of the WebSocket, SSE and aggregated streams and of NDJSON
+// downloads, each with the lineHash a client can resume from. Lines the
+// resume point has seen are skipped, with a gap message if the tail cap
+// cut off some it hadn't. filter picks lines and their context, and
+// keepTimestamps keeps the kubelet prefix on the log text. send gets each
+// message with the line's timestamp; an error from it stops the stream.
+// The error reading the stream, if any, is returned.
+func followLogs(stream io.Reader, filter *lineFilter, keepTimestamps bool, resume *resumePoint, send func(timestamp string, msg gin.H) error) error {
+	var selector *lineSelector
+	if filter != nil {
+		selector = newLineSelector(filter)
+	}
+	scanner := newLineScanner(stream)
+	for scanner.Scan() {
+		receivedAt := time.Now()
+		timestamp, text := splitTimestamp(scanner.Text())
+		if resume.seen(timestamp, text) {
+			continue
+		}
+		if resume.skipped() {
+			msg := gin.H{
+				"gap":        true,
+				"timestamp":  receivedAt.Format(time.RFC3339Nano),
+				"receivedAt": receivedAt.Format(time.RFC3339Nano),
+				"log":        "--- Some lines written while disconnected were skipped ---",
+			}
+			if err := send("", msg); err != nil {
+				return nil
+			}
+		}
+		selected := []filteredLine{{Timestamp: timestamp, Text: text}}
+		if selector != nil {
+			selected = selector.next(timestamp, text)
+		}
+		for _, line := range selected {
+			msg := logMessage(line, receivedAt)
+			msg["hash"] = lineHash(line.Text)
+			if keepTimestamps && line.Timestamp != "" {
+				// The client asked for the raw prefixed line as well
+				msg["log"] = line.Timestamp + " " + line.Text
+			}
+			if err := send(line.Timestamp, msg); err != nil {
+				return nil
+			}
+		}
+	}
+	return scanner.Err()
+}
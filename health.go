@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Readiness asks the Kubernetes API at most once per readyCacheTTL, so
+// probes from every kubelet and load balancer don't add up to API load, and
+// gives up on an unresponsive API server after readyCheckTimeout.
+const (
+	readyCacheTTL     = 5 * time.Second
+	readyCheckTimeout = 5 * time.Second
+)
+
+// healthCheck is one named check of /livez or /readyz.
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// podsListCheck verifies the service account can list pods in namespace,
+// caching the result for ttl.
+type podsListCheck struct {
+	clientset kubernetes.Interface
+	namespace string
+	ttl       time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+func newPodsListCheck(clientset kubernetes.Interface, namespace string) *podsListCheck {
+	return &podsListCheck{clientset: clientset, namespace: namespace, ttl: readyCacheTTL}
+}
+
+// check returns the cached result, or lists pods again once it is older
+// than the TTL. Changes between passing and failing are logged.
+func (p *podsListCheck) check(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.checked.IsZero() && time.Since(p.checked) < p.ttl {
+		return p.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+	defer cancel()
+	_, err := p.clientset.CoreV1().Pods(p.namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	err = p.explain(err)
+	if (err == nil) != (p.err == nil) {
+		if err != nil {
+			fmt.Println("Not ready:", err)
+		} else {
+			fmt.Println("Ready: Kubernetes API reachable again")
+		}
+	}
+	p.checked = time.Now()
+	p.err = err
+	return err
+}
+
+// explain turns a failed list into a message saying what to fix, with
+// RBAC problems spelled out.
+func (p *podsListCheck) explain(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case apierrors.IsForbidden(err):
+		return fmt.Errorf("RBAC: the service account may not list pods in namespace %s, check its Role and RoleBinding: %v", p.namespace, err)
+	case apierrors.IsUnauthorized(err):
+		return fmt.Errorf("the Kubernetes API rejected the service account's credentials: %v", err)
+	default:
+		return fmt.Errorf("listing pods in namespace %s failed: %v", p.namespace, err)
+	}
+}
+
+// healthHandler runs checks and answers 200 if they all pass, 503 if not.
+// With ?verbose each check is listed, like the Kubernetes API server's own
+// /livez and /readyz; otherwise only failures are.
+func healthHandler(name string, checks []healthCheck) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, verbose := c.GetQuery("verbose")
+		var out strings.Builder
+		failed := false
+		for _, hc := range checks {
+			if err := hc.check(c.Request.Context()); err != nil {
+				failed = true
+				fmt.Fprintf(&out, "[-]%s failed: %v\n", hc.name, err)
+			} else if verbose {
+				fmt.Fprintf(&out, "[+]%s ok\n", hc.name)
+			}
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.Header("X-Content-Type-Options", "nosniff")
+		switch {
+		case failed:
+			fmt.Fprintf(&out, "%s check failed\n", name)
+			c.String(http.StatusServiceUnavailable, out.String())
+		case verbose:
+			fmt.Fprintf(&out, "%s check passed\n", name)
+			c.String(http.StatusOK, out.String())
+		default:
+			c.String(http.StatusOK, "ok")
+		}
+	}
+}
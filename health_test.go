@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func healthRequest(t *testing.T, router http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestReadyz tests that readiness checks the Kubernetes API and lists each check when verbose
+func TestReadyz(t *testing.T) {
+	router := newTestRouter(t, "secret")
+
+	require.Eventually(t, func() bool {
+		return healthRequest(t, router, "/readyz").Code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "ok", healthRequest(t, router, "/readyz").Body.String())
+
+	w := healthRequest(t, router, "/readyz?verbose")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[+]ping ok\n[+]kubernetes-api ok\n[+]pod-cache ok\nreadyz check passed\n", w.Body.String())
+
+	w = healthRequest(t, router, "/livez?verbose")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[+]ping ok\nlivez check passed\n", w.Body.String())
+}
+
+// TestReadyzReportsRBAC tests that a service account without access to pods is not ready and says why
+func TestReadyzReportsRBAC(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", nil)
+	})
+	router := newTestRouterWith(t, func(opts *routerOptions) { opts.clientset = clientset })
+
+	w := healthRequest(t, router, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "[-]kubernetes-api failed: RBAC: the service account may not list pods in namespace default")
+	assert.NotContains(t, w.Body.String(), "[+]ping", "only failures without verbose")
+	assert.Contains(t, w.Body.String(), "readyz check failed")
+
+	// The process itself is fine
+	assert.Equal(t, http.StatusOK, healthRequest(t, router, "/livez").Code)
+}
+
+// TestPodsListCheckCaches tests that the API is asked at most once per TTL
+func TestPodsListCheckCaches(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	var lists int32
+	clientset.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		atomic.AddInt32(&lists, 1)
+		return false, nil, nil
+	})
+	check := newPodsListCheck(clientset, "default")
+	check.ttl = 50 * time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, check.check(context.Background()))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lists))
+
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, check.check(context.Background()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&lists))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLineSize is the longest log line relayed or filtered. bufio.Scanner's
+// default of 64 KiB is easily exceeded by structured logs.
+const maxLineSize = 1024 * 1024
+
+// newLineScanner returns a scanner reading r line by line, allowing lines
+// of up to maxLineSize.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return scanner
+}
+
+// splitTimestamp splits off the RFC3339Nano timestamp the kubelet prefixes
+// to every line when PodLogOptions.Timestamps is set. Lines without a valid
+// prefix are returned unchanged with an empty timestamp.
+func splitTimestamp(line string) (timestamp, text string) {
+	i := strings.IndexByte(line, ' ')
+	if i <= 0 {
+		return "", line
+	}
+	if _, err := time.Parse(time.RFC3339Nano, line[:i]); err != nil {
+		return "", line
+	}
+	return line[:i], line[i+1:]
+}
+
+// logMessage builds the WebSocket message for a streamed line. timestamp is
+// when the container wrote the line and receivedAt when it was relayed;
+// lines without a kubelet timestamp fall back to receivedAt. Structured
+// lines get their parsed fields attached.
+func logMessage(line filteredLine, receivedAt time.Time) gin.H {
+	msg := gin.H{
+		"timestamp":  line.Timestamp,
+		"receivedAt": receivedAt.Format(time.RFC3339Nano),
+		"log":        line.Text,
+	}
+	if line.Timestamp == "" {
+		msg["timestamp"] = msg["receivedAt"]
+	}
+	if line.Context {
+		msg["context"] = true
+	}
+	addStructuredFields(msg, line.Text)
+	return msg
+}
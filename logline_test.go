@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSplitTimestamp tests that the kubelet timestamp prefix is split off
+func TestSplitTimestamp(t *testing.T) {
+	ts, text := splitTimestamp("2024-05-01T12:00:00.123456789Z hello world")
+	assert.Equal(t, "2024-05-01T12:00:00.123456789Z", ts)
+	assert.Equal(t, "hello world", text)
+
+	for _, line := range []string{"hello world", "", " leading space", "2024-05-01 not a timestamp"} {
+		ts, text := splitTimestamp(line)
+		assert.Empty(t, ts, line)
+		assert.Equal(t, line, text, line)
+	}
+}
+
+// TestLogMessage tests that messages carry the line timestamp and when it was received
+func TestLogMessage(t *testing.T) {
+	received := time.Date(2024, 5, 1, 12, 0, 1, 0, time.UTC)
+
+	msg := logMessage(filteredLine{Timestamp: "2024-05-01T12:00:00.5Z", Text: "hello"}, received)
+	assert.Equal(t, "2024-05-01T12:00:00.5Z", msg["timestamp"])
+	assert.Equal(t, "2024-05-01T12:00:01Z", msg["receivedAt"])
+	assert.Equal(t, "hello", msg["log"])
+	assert.NotContains(t, msg, "context")
+
+	msg = logMessage(filteredLine{Text: `{"level":"info"}`, Context: true}, received)
+	assert.Equal(t, "2024-05-01T12:00:01Z", msg["timestamp"])
+	assert.Equal(t, true, msg["context"])
+	assert.Equal(t, "info", msg["level"])
+}
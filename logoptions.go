@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// tailLimits bounds the number of lines an endpoint returns.
+type tailLimits struct {
+	// defaultLines is the tail length used when a request gives neither
+	// lines nor a since* parameter; 0 returns the whole log.
+	defaultLines int64
+	// maxLines caps the tail length a request may ask for and, when set,
+	// applies to requests that would otherwise get the whole log; 0 means
+	// no cap.
+	maxLines int64
+}
+
+// withDefault returns a copy of l using defaultLines as its default.
+func (l tailLimits) withDefault(defaultLines int64) tailLimits {
+	l.defaultLines = defaultLines
+	return l
+}
+
+// logOptionsFromQuery builds the PodLogOptions for a request from its query
+// parameters. Supported parameters are lines, previous, sinceSeconds,
+// sinceTime (RFC3339), timestamps and limitBytes. limits supplies the tail
+// length used when neither lines nor a since* parameter is given, and the
+// most lines a request may ask for. An error is returned for the first
+// parameter that fails validation so handlers can answer with 400 instead
+// of guessing.
+func logOptionsFromQuery(c *gin.Context, container string, limits tailLimits) (*corev1.PodLogOptions, error) {
+	opts := &corev1.PodLogOptions{Container: container}
+
+	if v, ok := c.GetQuery("lines"); ok {
+		lines, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || lines < 0 {
+			return nil, fmt.Errorf("invalid lines parameter %q: must be a non-negative integer", v)
+		}
+		if limits.maxLines > 0 && lines > limits.maxLines {
+			return nil, fmt.Errorf("invalid lines parameter %q: must be at most %d", v, limits.maxLines)
+		}
+		opts.TailLines = &lines
+	}
+
+	if v, ok := c.GetQuery("previous"); ok {
+		previous, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid previous parameter %q: must be a boolean", v)
+		}
+		opts.Previous = previous
+	}
+
+	if v, ok := c.GetQuery("timestamps"); ok {
+		timestamps, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamps parameter %q: must be a boolean", v)
+		}
+		opts.Timestamps = timestamps
+	}
+
+	if v, ok := c.GetQuery("sinceSeconds"); ok {
+		seconds, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid sinceSeconds parameter %q: must be a positive integer", v)
+		}
+		opts.SinceSeconds = &seconds
+	}
+
+	if v, ok := c.GetQuery("sinceTime"); ok {
+		if opts.SinceSeconds != nil {
+			return nil, fmt.Errorf("sinceSeconds and sinceTime are mutually exclusive")
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sinceTime parameter %q: must be an RFC3339 timestamp", v)
+		}
+		sinceTime := metav1.NewTime(t)
+		opts.SinceTime = &sinceTime
+	}
+
+	if v, ok := c.GetQuery("limitBytes"); ok {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limitBytes parameter %q: must be a positive integer", v)
+		}
+		opts.LimitBytes = &limit
+	}
+
+	if opts.TailLines == nil && opts.SinceSeconds == nil && opts.SinceTime == nil && limits.defaultLines > 0 {
+		defaultLines := limits.defaultLines
+		opts.TailLines = &defaultLines
+	}
+	if opts.TailLines == nil && limits.maxLines > 0 {
+		maxLines := limits.maxLines
+		opts.TailLines = &maxLines
+	}
+
+	return opts, nil
+}
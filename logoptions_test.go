@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testContext(target string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", target, nil)
+	return c
+}
+
+// TestLogOptionsDefaults tests that the default tail length is applied when no options are given
+func TestLogOptionsDefaults(t *testing.T) {
+	opts, err := logOptionsFromQuery(testContext("/api/logs/p/c"), "c", tailLimits{defaultLines: 100})
+	require.NoError(t, err)
+
+	assert.Equal(t, "c", opts.Container)
+	require.NotNil(t, opts.TailLines)
+	assert.Equal(t, int64(100), *opts.TailLines)
+	assert.False(t, opts.Previous)
+	assert.False(t, opts.Timestamps)
+	assert.Nil(t, opts.SinceSeconds)
+	assert.Nil(t, opts.SinceTime)
+	assert.Nil(t, opts.LimitBytes)
+}
+
+// TestLogOptionsAllParameters tests that every supported parameter is mapped onto PodLogOptions
+func TestLogOptionsAllParameters(t *testing.T) {
+	opts, err := logOptionsFromQuery(testContext("/?lines=5&previous=true&timestamps=1&sinceTime=2025-01-02T03:04:05Z&limitBytes=2048"), "c", tailLimits{defaultLines: 100})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(5), *opts.TailLines)
+	assert.True(t, opts.Previous)
+	assert.True(t, opts.Timestamps)
+	assert.True(t, opts.SinceTime.Time.Equal(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)))
+	assert.Equal(t, int64(2048), *opts.LimitBytes)
+}
+
+// TestLogOptionsSinceSkipsDefaultTail tests that a since* parameter disables the default tail length
+func TestLogOptionsSinceSkipsDefaultTail(t *testing.T) {
+	opts, err := logOptionsFromQuery(testContext("/?sinceSeconds=300"), "c", tailLimits{defaultLines: 100})
+	require.NoError(t, err)
+
+	assert.Nil(t, opts.TailLines)
+	assert.Equal(t, int64(300), *opts.SinceSeconds)
+}
+
+// TestLogOptionsInvalidValues tests that malformed parameters are rejected
+func TestLogOptionsInvalidValues(t *testing.T) {
+	cases := map[string]string{
+		"lines=abc":           "invalid lines parameter",
+		"lines=-1":            "invalid lines parameter",
+		"previous=maybe":      "invalid previous parameter",
+		"timestamps=yes":      "invalid timestamps parameter",
+		"sinceSeconds=0":      "invalid sinceSeconds parameter",
+		"sinceTime=yesterday": "invalid sinceTime parameter",
+		"limitBytes=-5":       "invalid limitBytes parameter",
+		"sinceSeconds=10&sinceTime=2025-01-02T03:04:05Z": "mutually exclusive",
+	}
+
+	for query, want := range cases {
+		_, err := logOptionsFromQuery(testContext("/?"+query), "c", tailLimits{defaultLines: 100})
+		if assert.Error(t, err, query) {
+			assert.Contains(t, err.Error(), want, query)
+		}
+	}
+}
+
+// TestLogOptionsMaxLines tests that the configured maximum rejects larger requests and caps unbounded ones
+func TestLogOptionsMaxLines(t *testing.T) {
+	limits := tailLimits{defaultLines: 100, maxLines: 500}
+
+	_, err := logOptionsFromQuery(testContext("/?lines=501"), "c", limits)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "must be at most 500")
+	}
+
+	opts, err := logOptionsFromQuery(testContext("/?sinceSeconds=300"), "c", limits)
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), *opts.TailLines)
+
+	opts, err = logOptionsFromQuery(testContext("/"), "c", tailLimits{})
+	require.NoError(t, err)
+	assert.Nil(t, opts.TailLines)
+}
@@ -3,19 +3,22 @@ package main
 import (
   "net/http"
   "os"
+  "path/filepath"
+  "os/signal"
+  "syscall"
   "github.com/gin-gonic/gin"
   "context"
+  "crypto/subtle"
+  "encoding/json"
+  "flag"
   "fmt"
+  "net/url"
   "strings"
-  "strconv"
-  "io"
   "time"
-  "bufio"
   "runtime/debug"
   _ "embed"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-  corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -53,95 +56,295 @@ func getVersion() string {
 	return "dev"
 }
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for simplicity
-	},
+// newUpgrader returns the WebSocket upgrader for the router. Browsers send
+// an Origin header with every upgrade; when allowedOrigins is set only those
+// origins (or "*") may connect, otherwise only pages served by this host
+// may, so other sites a signed-in user visits can't open streams with the
+// user's cookie. Requests without an Origin header don't come from a
+// browser and are let through.
+func newUpgrader(allowedOrigins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		Subprotocols: []string{wsProtocol},
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			if len(allowedOrigins) == 0 {
+				u, err := url.Parse(origin)
+				return err == nil && strings.EqualFold(u.Host, r.Host)
+			}
+			for _, allowed := range allowedOrigins {
+				if allowed == "*" || strings.EqualFold(allowed, origin) {
+					return true
+				}
+			}
+			return false
+		},
+	}
 }
 
-type PodContainer struct {
-	PodName       string `json:"podName"`
-	ContainerName string `json:"containerName"`
-	Namespace     string `json:"namespace"`
-	ID            string `json:"id"`
+// routerOptions holds what setupRouter needs from its environment, so the
+// router can be built against a fake clientset in tests.
+type routerOptions struct {
+  // clientset is used for every Kubernetes API call
+  clientset kubernetes.Interface
+  // namespace is the default namespace, served by the unprefixed routes
+  namespace string
+  // namespaces lists additional namespaces to serve, comma separated, or
+  // "*" for all of them (the NAMESPACES variable)
+  namespaces string
+  // logKey, when set, is required as ?key= or X-API-Key on API requests
+  logKey string
+  // stopCh stops the pod informers when closed; nil runs them forever
+  stopCh <-chan struct{}
+  // tailLimits are the default and maximum lines returned per container
+  tailLimits tailLimits
+  // allowedOrigins may open WebSockets; empty allows the same origin only
+  allowedOrigins []string
+  // features switches optional endpoints on and off
+  features featuresConfig
+  // drainer tracks WebSocket streams for graceful shutdown; nil never
+  // drains them
+  drainer *drainer
+  // oidc signs users in with an OpenID Connect provider; nil disables it
+  oidc *oidcAuth
+  // auditor records access to logs; nil disables the audit log
+  auditor *auditor
+  // kubeAuth accepts Kubernetes bearer tokens and checks log access with
+  // RBAC; nil disables it
+  kubeAuth *kubeAuthorizer
+  // apiKeys are named, scoped API keys from the key file; nil disables
+  // them
+  apiKeys *apiKeyStore
 }
 
-func setupRouter() *gin.Engine {
-  // Disable Console Color
-  gin.DisableConsoleColor()
-  if os.Getenv("DEBUG") != "" {
-    gin.SetMode(gin.DebugMode)
-  } else {
-    gin.SetMode(gin.ReleaseMode)
+// kubernetesClient builds a clientset from the in-cluster config, falling
+// back to the local kubeconfig, and works out the namespace to serve by
+// default: the pod's own namespace in cluster, otherwise the kubeconfig
+// namespace or "default". An explicit kubeconfig file or context skips the
+// in-cluster config. kubeconfig may list several files like KUBECONFIG
+// does, which are merged.
+func kubernetesClient(kubeconfig, kubeContext string) (kubernetes.Interface, string, error) {
+  loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+  if paths := filepath.SplitList(kubeconfig); len(paths) == 1 {
+    loadingRules.ExplicitPath = paths[0]
+  } else if len(paths) > 1 {
+    loadingRules.Precedence = paths
   }
-  logkey := os.Getenv("LOGKEY")
-  fmt.Println("Logkey is: ", logkey)
+  configOverrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+  kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
 
-  // k8s client setup - try in-cluster config first, fall back to kubeconfig
   var config *rest.Config
   var err error
-
-  config, err = rest.InClusterConfig()
-  if err != nil {
+  if kubeconfig == "" && kubeContext == "" {
+    config, err = rest.InClusterConfig()
+  }
+  if config == nil {
     // Not in cluster, try kubeconfig
-    loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-    configOverrides := &clientcmd.ConfigOverrides{}
-    kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
     config, err = kubeConfig.ClientConfig()
     if err != nil {
-      panic(fmt.Sprintf("Failed to load kubernetes config: %v", err))
+      return nil, "", fmt.Errorf("failed to load kubernetes config: %v", err)
     }
   }
 
   clientset, err := kubernetes.NewForConfig(config)
   if err != nil {
-    panic(err.Error())
+    return nil, "", err
   }
 
-  // Get the namespace - try in-cluster first, fall back to kubeconfig namespace or "default"
   var namespace string
   namespaceByte, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
   if err == nil {
     namespace = string(namespaceByte)
   } else {
     // Not in cluster, get namespace from kubeconfig or use default
-    loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-    configOverrides := &clientcmd.ConfigOverrides{}
-    kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
     namespace, _, err = kubeConfig.Namespace()
     if err != nil || namespace == "" {
       namespace = "default"
     }
   }
-  fmt.Println("Using namespace:", namespace)
+  return clientset, namespace, nil
+}
+
+func setupRouter(opts routerOptions) *gin.Engine {
+  clientset := opts.clientset
+  namespace := opts.namespace
+  logkey := opts.logKey
+  stopCh := opts.stopCh
+  if stopCh == nil {
+    stopCh = make(chan struct{})
+  }
+  upgrader := newUpgrader(opts.allowedOrigins)
+  drainer := opts.drainer
+  if drainer == nil {
+    drainer = newDrainer()
+  }
+
+  // Namespaces served besides the default one: a comma separated
+  // allow-list, or "*" for every namespace (needs a ClusterRole)
+  namespaces := newNamespaceRegistry(clientset, namespace, opts.namespaces, stopCh)
+  if namespaces.all {
+    fmt.Println("Serving namespaces: all")
+  } else {
+    fmt.Println("Serving namespaces:", strings.Join(namespaces.allowed, ","))
+  }
+
+  // Serve pod reads from a shared informer instead of listing per request
+  pods := namespaces.cache(namespace)
 
   r := gin.New()
   r.Use(
-        gin.LoggerWithWriter(gin.DefaultWriter, "/healthcheck"),
+        // Keys and tokens in query strings stay out of the request log
+        gin.LoggerWithConfig(gin.LoggerConfig{
+          Formatter: accessLogFormatter,
+          Output:    gin.DefaultWriter,
+          SkipPaths: []string{"/healthcheck", "/livez", "/readyz"},
+        }),
         gin.Recovery(),
+        metricsMiddleware,
   )
 
+  // authenticate accepts a Kubernetes bearer token, a signed-in session,
+  // a named key from the key file or, if one is set, the API key. With
+  // none configured everything is open.
+  authenticate := func(c *gin.Context, key string) bool {
+    if opts.kubeAuth != nil {
+      if token := bearerToken(c.Request); token != "" {
+        user, err := opts.kubeAuth.authenticate(c.Request.Context(), token)
+        if err != nil {
+          fmt.Println("Kubernetes token rejected:", err)
+          return false
+        }
+        c.Set(kubeUserKey, user)
+        c.Set(userKey, user.Username)
+        c.Set(authMethodKey, authMethodKubernetes)
+        return true
+      }
+    }
+    if opts.oidc != nil {
+      if s, ok := opts.oidc.session(c.Request); ok {
+        c.Set(userKey, s.user())
+        c.Set(authMethodKey, authMethodOIDC)
+        return true
+      }
+    }
+    if opts.apiKeys != nil && key != "" {
+      if k, ok := opts.apiKeys.lookup(key); ok {
+        c.Set(apiKeyContextKey, k)
+        c.Set(userKey, "key:"+k.Name)
+        c.Set(authMethodKey, authMethodAPIKey)
+        fmt.Printf("API key %q: %s %s\n", k.Name, c.Request.Method, c.Request.URL.Path)
+        return true
+      }
+    }
+    if logkey != "" {
+      if subtle.ConstantTimeCompare([]byte(logkey), []byte(key)) != 1 {
+        return false
+      }
+      c.Set(authMethodKey, authMethodLogKey)
+      return true
+    }
+    if opts.oidc != nil || opts.kubeAuth != nil || opts.apiKeys != nil {
+      return false
+    }
+    c.Set(authMethodKey, authMethodNone)
+    return true
+  }
+  deny := func(c *gin.Context) {
+    authFailures.WithLabelValues(authFailureUnauthenticated).Inc()
+    if opts.oidc != nil {
+      c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in required", "login": "/login"})
+    } else if opts.kubeAuth != nil {
+      c.Header("WWW-Authenticate", "Bearer")
+      c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or missing bearer token"})
+    } else {
+      c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or missing API key"})
+    }
+    c.Abort()
+  }
+
   // Authentication middleware
   authMiddleware := func(c *gin.Context) {
-    if os.Getenv("LOGKEY") != "" {
-      key := c.Query("key")
-      if key == "" {
-        key = c.GetHeader("X-API-Key")
-      }
-      if os.Getenv("LOGKEY") != key {
-        c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or missing API key"})
-        c.Abort()
+    key := c.Query("key")
+    if key == "" {
+      key = c.GetHeader("X-API-Key")
+    }
+    if !authenticate(c, key) {
+      deny(c)
+      return
+    }
+    c.Next()
+  }
+
+  // WebSocket authentication - browsers can't set headers on upgrade
+  // requests, but do send the session cookie and can pass the key as a
+  // subprotocol, or redeem a ticket from /api/ws-ticket
+  tickets := newWSTicketStore()
+  wsAuthMiddleware := func(c *gin.Context) {
+    if ticket := c.Query("ticket"); ticket != "" {
+      if !tickets.redeem(c, ticket) {
+        deny(c)
         return
       }
+      c.Next()
+      return
+    }
+    key := wsProtocolKey(c.Request)
+    if key == "" {
+      key = c.GetHeader("X-API-Key")
+    }
+    if key == "" {
+      key = c.Query("key")
+    }
+    if !authenticate(c, key) {
+      deny(c)
+      return
     }
     c.Next()
   }
 
+  // Sign-in with OpenID Connect
+  if opts.oidc != nil {
+    r.GET("/login", opts.oidc.loginHandler)
+    r.GET(oidcCallbackPath, opts.oidc.callbackHandler)
+    r.GET("/logout", opts.oidc.logoutHandler)
+  }
+
+  // API: Who the caller is signed in as, for the UI
+  r.GET("/api/session", authMiddleware, func(c *gin.Context) {
+    resp := gin.H{"user": c.GetString(userKey)}
+    if opts.oidc != nil {
+      resp["logout"] = "/logout"
+    }
+    c.JSON(http.StatusOK, resp)
+  })
+
+  // API: A single-use ticket authenticating one WebSocket as the caller
+  r.POST("/api/ws-ticket", authMiddleware, tickets.handler)
+
   // Health check
   r.GET("/healthcheck", func(c *gin.Context) {
     c.String(http.StatusOK, "still alive")
   })
 
+  // Liveness only covers the process, so an API server outage doesn't
+  // get every replica restarted; readiness needs the Kubernetes API
+  r.GET("/livez", healthHandler("livez", []healthCheck{
+    {name: "ping", check: func(context.Context) error { return nil }},
+  }))
+  podsList := newPodsListCheck(clientset, namespace)
+  r.GET("/readyz", healthHandler("readyz", []healthCheck{
+    {name: "ping", check: func(context.Context) error { return nil }},
+    {name: "kubernetes-api", check: podsList.check},
+    {name: "pod-cache", check: func(context.Context) error {
+      if !pods.informer.HasSynced() {
+        return fmt.Errorf("pod cache for namespace %s has not synced yet", namespace)
+      }
+      return nil
+    }},
+  }))
+
   // Version endpoint
   r.GET("/version", func(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{
@@ -150,30 +353,79 @@ func setupRouter() *gin.Engine {
     })
   })
 
+  // Prometheus metrics, open so they can be scraped
+  relayPodLabels.Store(opts.features.MetricsPodLabels)
+  if opts.features.Metrics {
+    r.GET("/metrics", metricsHandler())
+  }
+
   // Serve the UI
-  r.GET("/", func(c *gin.Context) {
-    c.Header("Content-Type", "text/html")
-    c.String(http.StatusOK, getHTMLUI())
+  if opts.features.UI {
+    r.GET("/", func(c *gin.Context) {
+      // Send browsers without a session to sign in first; a valid ?key=
+      // still works as before
+      if opts.oidc != nil && !authenticate(c, c.Query("key")) {
+        c.Redirect(http.StatusFound, "/login?redirect="+url.QueryEscape(c.Request.URL.RequestURI()))
+        return
+      }
+      c.Header("Content-Type", "text/html")
+      c.String(http.StatusOK, getHTMLUI())
+    })
+  }
+
+  // API: List the namespaces this instance serves
+  r.GET("/api/namespaces", authMiddleware, func(c *gin.Context) {
+    list, err := namespaces.list(c.Request.Context())
+    if err != nil {
+      c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+      return
+    }
+    // A scoped key only sees its namespaces
+    if value, ok := c.Get(apiKeyContextKey); ok {
+      var scoped []string
+      for _, ns := range list {
+        if value.(*apiKey).allowsNamespace(ns) {
+          scoped = append(scoped, ns)
+        }
+      }
+      list = scoped
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+      "default": namespace,
+      "all": namespaces.all,
+      "namespaces": list,
+    })
   })
 
+  nsMiddleware := namespaceMiddleware(namespaces)
+  // Record who read which logs, including denied attempts
+  audit := opts.auditor.middleware(namespace)
+  // Callers with Kubernetes tokens need get pods/log on what they read,
+  // and callers with named keys need it in the key's scope
+  logsAccess := logsAccessMiddleware(opts.kubeAuth, namespace, false)
+  downloadAccess := logsAccessMiddleware(opts.kubeAuth, namespace, true)
+
   // API: List all pods and containers
-  r.GET("/api/containers", authMiddleware, func(c *gin.Context) {
-    pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
+  containersHandler := func(c *gin.Context) {
+    namespace := c.GetString("namespace")
+    pods := namespaces.cache(namespace)
+    if err := pods.waitForSync(c.Request.Context()); err != nil {
+      c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+      return
+    }
+    podList, err := pods.list(labels.Everything())
     if err != nil {
       c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
       return
     }
 
+    // Only list pods whose logs the caller may read
+    visible := visiblePods(c, opts.kubeAuth, namespace)
     var containers []PodContainer
-    for _, pod := range pods.Items {
-      for _, container := range pod.Spec.Containers {
-        id := fmt.Sprintf("%s/%s", pod.Name, container.Name)
-        containers = append(containers, PodContainer{
-          PodName:       pod.Name,
-          ContainerName: container.Name,
-          Namespace:     namespace,
-          ID:            id,
-        })
+    for _, pod := range podList {
+      if visible(pod.Name) {
+        containers = append(containers, podContainers(pod)...)
       }
     }
 
@@ -181,27 +433,28 @@ func setupRouter() *gin.Engine {
       "namespace": namespace,
       "containers": containers,
     })
-  })
+  }
 
   // API: Get logs for a specific container
-  r.GET("/api/logs/:pod/:container", authMiddleware, func(c *gin.Context) {
+  logsHandler := func(c *gin.Context) {
+    namespace := c.GetString("namespace")
     podName := c.Param("pod")
     containerName := c.Param("container")
 
-    var loglines = int64(100)
-    if linesParam := c.Query("lines"); linesParam != "" {
-      if linesVal, err := strconv.Atoi(linesParam); err == nil {
-        loglines = int64(linesVal)
-      }
+    podLogOpts, err := logOptionsFromQuery(c, containerName, opts.tailLimits)
+    if err != nil {
+      c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+      return
     }
-
-    podLogOpts := corev1.PodLogOptions{
-      Container: containerName,
-      TailLines: &loglines,
+    filter, err := lineFilterFromQuery(c)
+    if err != nil {
+      c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+      return
     }
 
-    req := clientset.CoreV1().Pods(namespace).GetLogs(podName, &podLogOpts)
-    logStream, err := req.Stream(context.TODO())
+    // Tied to the request, so a client that goes away ends the stream
+    req := clientset.CoreV1().Pods(namespace).GetLogs(podName, podLogOpts)
+    logStream, err := openLogStream(c.Request.Context(), req)
     if err != nil {
       c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
       return
@@ -209,45 +462,61 @@ func setupRouter() *gin.Engine {
     defer logStream.Close()
 
     buf := new(strings.Builder)
-    io.Copy(buf, logStream)
+    if err := copyFiltered(buf, logStream, filter); err != nil {
+      c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+      return
+    }
 
     c.JSON(http.StatusOK, gin.H{
       "pod":       podName,
       "container": containerName,
       "logs":      buf.String(),
     })
-  })
+  }
 
   // WebSocket: Stream logs in real-time
-  r.GET("/ws/logs/:pod/:container", func(c *gin.Context) {
-    // Check authentication for WebSocket
-    if os.Getenv("LOGKEY") != "" {
-      key := c.Query("key")
-      if os.Getenv("LOGKEY") != key {
-        c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or missing API key"})
-        return
-      }
-    }
-
+  wsLogsHandler := func(c *gin.Context) {
+    namespace := c.GetString("namespace")
     podName := c.Param("pod")
     containerName := c.Param("container")
 
-    conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+    // Validate options before upgrading so bad requests get a plain 400
+    podLogOpts, err := logOptionsFromQuery(c, containerName, opts.tailLimits)
     if err != nil {
-      fmt.Println("WebSocket upgrade failed:", err)
+      c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
       return
     }
-    defer conn.Close()
-
-    // Stream logs with follow enabled
-    podLogOpts := corev1.PodLogOptions{
-      Container: containerName,
-      Follow:    true,
-      TailLines: func(i int64) *int64 { return &i }(100),
+    filter, err := lineFilterFromQuery(c)
+    if err != nil {
+      c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+      return
+    }
+    // A reconnecting client continues after the last line it got instead
+    // of getting the tail again
+    var resume *resumePoint
+    if resumeFrom := c.Query("resumeFrom"); resumeFrom != "" {
+      resume, err = parseResumePoint(resumeFrom)
+      if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+      }
+      resume.apply(podLogOpts, opts.tailLimits)
+    }
+    // Stream logs with follow enabled, and ask for timestamps so each
+    // message carries when the line was written rather than relayed
+    podLogOpts.Follow = true
+    keepTimestamps := podLogOpts.Timestamps
+    podLogOpts.Timestamps = true
+
+    conn, ok := upgradeSession(c, upgrader, drainer)
+    if !ok {
+      return
     }
+    defer conn.Close()
 
-    req := clientset.CoreV1().Pods(namespace).GetLogs(podName, &podLogOpts)
-    logStream, err := req.Stream(context.TODO())
+    // The stream ends when the session does, including on shutdown
+    req := clientset.CoreV1().Pods(namespace).GetLogs(podName, podLogOpts)
+    logStream, err := openLogStream(conn.ctx, req)
     if err != nil {
       conn.WriteJSON(gin.H{"error": err.Error()})
       return
@@ -255,75 +524,234 @@ func setupRouter() *gin.Engine {
     defer logStream.Close()
 
     // Read logs line by line and send over WebSocket
-    scanner := bufio.NewScanner(logStream)
-    for scanner.Scan() {
-      line := scanner.Text()
-      if err := conn.WriteJSON(gin.H{
-        "timestamp": time.Now().Format(time.RFC3339),
-        "log":       line,
-      }); err != nil {
-        break
-      }
-    }
-
-    if err := scanner.Err(); err != nil {
+    err = followLogs(logStream, filter, keepTimestamps, resume, func(_ string, msg gin.H) error {
+      return conn.WriteJSON(msg)
+    })
+    if err != nil && conn.ctx.Err() == nil {
       conn.WriteJSON(gin.H{"error": err.Error()})
     }
-  })
+  }
 
-  // Legacy endpoint - keep for backward compatibility
-  r.GET("/logs", authMiddleware, func(c *gin.Context) {
-    var output = ""
-    var loglines = int64(20)
-    loglinesval, err := strconv.Atoi(strings.Join(c.Request.URL.Query()["lines"], " "))
-    if err == nil {
-      loglines = int64(loglinesval)
+  // Register the namespaced routes twice: the original paths serve the
+  // default namespace, the /namespaces/:ns paths serve any allowed one
+  for _, prefix := range []string{"", "/namespaces/:ns"} {
+    r.GET("/api"+prefix+"/containers", authMiddleware, nsMiddleware, containersHandler)
+    // Push pod/container changes as they happen
+    r.GET("/api"+prefix+"/containers/watch", wsAuthMiddleware, nsMiddleware, containerWatchHandler(namespaces, upgrader, drainer, opts.kubeAuth))
+    r.GET("/api"+prefix+"/logs/all", audit, authMiddleware, nsMiddleware, logsAccess, allLogsHandler(clientset, namespaces, opts.tailLimits))
+    r.GET("/api"+prefix+"/logs/:pod/:container", audit, authMiddleware, nsMiddleware, logsAccess, logsHandler)
+    if opts.features.Downloads {
+      r.GET("/api"+prefix+"/logs/:pod/:container/download", audit, authMiddleware, nsMiddleware, downloadAccess, logDownloadHandler(clientset, opts.tailLimits))
+      r.GET("/api"+prefix+"/bundle", audit, authMiddleware, nsMiddleware, downloadAccess, bundleHandler(clientset, namespaces, opts.kubeAuth, opts.tailLimits))
     }
-
-    // get all pods in our namespace
-    pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
-    if err != nil {
-        panic(err.Error())
+    // The same follow stream as Server-Sent Events
+    r.GET("/api"+prefix+"/logs/:pod/:container/stream", audit, authMiddleware, nsMiddleware, logsAccess, logEventStreamHandler(clientset, drainer, opts.tailLimits))
+    r.GET("/ws"+prefix+"/logs/:pod/:container", audit, wsAuthMiddleware, nsMiddleware, logsAccess, wsLogsHandler)
+    // Stream logs from every container matching a label selector
+    if opts.features.Aggregate {
+      r.GET("/ws"+prefix+"/logs", audit, wsAuthMiddleware, nsMiddleware, logsAccess, aggregateLogsHandler(clientset, namespaces, upgrader, drainer, opts.tailLimits))
     }
+  }
 
-    for i, pod := range pods.Items {
-      poddetails, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+  // Legacy endpoint - keep for backward compatibility
+  if opts.features.LegacyLogs {
+    r.GET("/logs", audit, authMiddleware, logsAccess, func(c *gin.Context) {
+      baseLogOpts, err := logOptionsFromQuery(c, "", opts.tailLimits.withDefault(20))
+      if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+      }
+      filter, err := lineFilterFromQuery(c)
       if err != nil {
-          panic(err.Error())
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
       }
-      for j, container := range poddetails.Spec.Containers {
-        podLogOpts := corev1.PodLogOptions{
-        Container: container.Name,
-        TailLines: &loglines,
-        }
 
-        buf := new(strings.Builder)
-        // get the logs here
-        req := clientset.CoreV1().Pods(namespace).GetLogs(pod.Name, &podLogOpts)
-        //
-        output += "\n\n\n-----------------------------\n"
-        output += fmt.Sprintf("ID: %d %d, \n Namespace: %s \n Pod: %s:\n Container: %s\n", i, j, namespace, pod.Name, container.Name)
-        output += "-----------------------------\n"
+      // get all pods in our namespace
+      ctx, cancel := context.WithTimeout(c.Request.Context(), cacheSyncTimeout)
+      err = pods.waitForSync(ctx)
+      cancel()
+      if err != nil {
+        c.String(http.StatusServiceUnavailable, "ERROR: %v\n", err)
+        return
+      }
+      podList, err := pods.list(labels.Everything())
+      if err != nil {
+        c.String(http.StatusInternalServerError, "ERROR: %v\n", err)
+        return
+      }
 
-        logoutput, err := req.Stream(context.TODO())
-        if err != nil {
-            panic(err.Error())
+      // Stream each container's section as soon as it is its turn, so the
+      // response is sent chunked instead of built up in memory. Containers
+      // that fail get an error section and are listed in the trailer.
+      c.Header("Content-Type", "text/plain; charset=utf-8")
+      c.Header("Trailer", logErrorsTrailer)
+      c.Status(http.StatusOK)
+      logErrors := []containerLogError{}
+      err = fetchNamespaceLogs(c.Request.Context(), clientset, namespace, podList, baseLogOpts, filter, namespaceLogsWorkers, func(result containerLogs) error {
+        if result.Err != nil {
+          logErrors = append(logErrors, containerLogError{Pod: result.Pod, Container: result.Container, Error: result.Err.Error()})
+        }
+        if err := writeLogsSection(c.Writer, namespace, result); err != nil {
+          return err
         }
-        io.Copy(buf,logoutput)
-        output += buf.String()
-        output += "-----------------------------\n\n\n\n\n"
+        c.Writer.Flush()
+        return nil
+      })
+      if err != nil {
+        fmt.Printf("/logs stopped early: %v\n", err)
+        return
       }
-     }
-
-     c.String(http.StatusOK, output)
-  })
+      summary, _ := json.Marshal(logErrors)
+      c.Writer.Header().Set(logErrorsTrailer, string(summary))
+    })
+  }
 
   return r
 }
 
 func main() {
+  cfg, printConfig, err := loadConfig(os.Args[1:], os.LookupEnv, os.Stderr)
+  if err == flag.ErrHelp {
+    return
+  }
+  if err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(2)
+  }
+  if printConfig {
+    if err := writeConfig(os.Stdout, cfg); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+    return
+  }
+
   fmt.Printf("k8s-simple-logs version %s\n", Version)
-  r := setupRouter()
-  // Listen and Server in 0.0.0.0:8080
-  r.Run(":8080")
+
+  // Disable Console Color
+  gin.DisableConsoleColor()
+  if cfg.Debug {
+    gin.SetMode(gin.DebugMode)
+  } else {
+    gin.SetMode(gin.ReleaseMode)
+  }
+  if cfg.Auth.LogKey != "" {
+    fmt.Println("Logkey is: ", redactedValue)
+  } else {
+    fmt.Println("Logkey is: ")
+  }
+
+  clientset, namespace, err := kubernetesClient(cfg.Kubeconfig, cfg.Context)
+  if err != nil {
+    panic(err.Error())
+  }
+  if cfg.Namespace != "" {
+    namespace = cfg.Namespace
+  }
+  fmt.Println("Using namespace:", namespace)
+
+  var oidcAuth *oidcAuth
+  if cfg.Auth.OIDC.enabled() {
+    oidcAuth, err = newOIDCAuth(context.Background(), cfg.Auth.OIDC)
+    if err != nil {
+      panic(err.Error())
+    }
+    fmt.Println("OIDC sign-in with", cfg.Auth.OIDC.IssuerURL)
+  }
+
+  stopCh := make(chan struct{})
+  var apiKeys *apiKeyStore
+  if cfg.Auth.KeyFile != "" {
+    apiKeys, err = newAPIKeyStore(cfg.Auth.KeyFile)
+    if err != nil {
+      panic(err.Error())
+    }
+    go apiKeys.watch(apiKeyReloadInterval, stopCh)
+    fmt.Println("API keys from", cfg.Auth.KeyFile)
+  }
+
+  var auditor *auditor
+  if cfg.Audit.enabled() {
+    auditor, err = newAuditor(cfg.Audit.Log, cfg.Audit.WebhookURL)
+    if err != nil {
+      panic(err.Error())
+    }
+    if cfg.Audit.WebhookURL != "" {
+      fmt.Println("Sending audit events to", redactURL(cfg.Audit.WebhookURL))
+    }
+  }
+
+  var kubeAuth *kubeAuthorizer
+  if cfg.Auth.KubernetesRBAC {
+    kubeAuth = newKubeAuthorizer(clientset)
+    fmt.Println("Authorizing Kubernetes bearer tokens with RBAC")
+  }
+
+  drainer := newDrainer()
+  r := setupRouter(routerOptions{
+    clientset:      clientset,
+    namespace:      namespace,
+    namespaces:     strings.Join(cfg.Namespaces, ","),
+    logKey:         cfg.Auth.LogKey,
+    stopCh:         stopCh,
+    tailLimits:     tailLimits{defaultLines: cfg.DefaultTailLines, maxLines: cfg.MaxTailLines},
+    allowedOrigins: cfg.AllowedOrigins,
+    features:       cfg.Features,
+    drainer:        drainer,
+    oidc:           oidcAuth,
+    kubeAuth:       kubeAuth,
+    apiKeys:        apiKeys,
+    auditor:        auditor,
+  })
+
+  srv := &http.Server{Addr: cfg.Listen, Handler: r}
+  serveErr := make(chan error, 1)
+  if cfg.TLS.CertFile != "" {
+    certs, err := newCertReloader(cfg.TLS)
+    if err != nil {
+      panic(err.Error())
+    }
+    go certs.watch(certReloadInterval, stopCh)
+    srv.TLSConfig = certs.tlsConfig(cfg.TLS.ClientAuth)
+    if cfg.TLS.ClientCAFile != "" {
+      fmt.Println("Listening with mutual TLS on", cfg.Listen)
+    } else {
+      fmt.Println("Listening with TLS on", cfg.Listen)
+    }
+    go func() { serveErr <- srv.ListenAndServeTLS("", "") }()
+  } else {
+    fmt.Println("Listening on", cfg.Listen)
+    go func() { serveErr <- srv.ListenAndServe() }()
+  }
+
+  // Kubernetes sends SIGTERM on rollout; drain instead of cutting every
+  // open stream
+  ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+  defer stop()
+  select {
+  case err := <-serveErr:
+    panic(err.Error())
+  case <-ctx.Done():
+  }
+  stop()
+
+  grace := time.Duration(cfg.ShutdownGracePeriodSeconds) * time.Second
+  fmt.Printf("Shutting down, waiting up to %s for open requests and streams\n", grace)
+  shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+  defer cancel()
+  // Shutdown doesn't wait for WebSockets, so they are told to reconnect
+  // elsewhere and waited for separately
+  drained := make(chan bool, 1)
+  go func() { drained <- drainer.drain(grace) }()
+  if err := srv.Shutdown(shutdownCtx); err != nil {
+    fmt.Println("Shutdown did not finish cleanly:", err)
+  }
+  if !<-drained {
+    fmt.Println("Some WebSocket streams did not close in time")
+  }
+  close(stopCh)
+  if auditor != nil {
+    auditor.close(5 * time.Second)
+  }
 }
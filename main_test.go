@@ -1,17 +1,67 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
+// newTestRouter builds the router against a fake clientset holding objects,
+// serving the "default" namespace. logKey is the API key to require, if any.
+// The fake clientset answers every log request with "fake logs".
+func newTestRouter(t *testing.T, logKey string, objects ...runtime.Object) http.Handler {
+	return newTestRouterWith(t, func(opts *routerOptions) { opts.logKey = logKey }, objects...)
+}
+
+// newTestRouterWith builds the router like newTestRouter, letting override
+// change the options first, e.g. to add an authenticator or to swap in a
+// clientset with reactors, in which case objects aren't used.
+func newTestRouterWith(t *testing.T, override func(*routerOptions), objects ...runtime.Object) http.Handler {
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	opts := routerOptions{
+		clientset:  fake.NewSimpleClientset(objects...),
+		namespace:  "default",
+		stopCh:     stopCh,
+		tailLimits: tailLimits{defaultLines: 100},
+		features:   defaultConfig().Features,
+	}
+	override(&opts)
+	return setupRouter(opts)
+}
+
+func testPod(name string, containers ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	for _, container := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: container, Image: container + ":latest"})
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+			Name:  container,
+			Ready: true,
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+		})
+	}
+	return pod
+}
+
 // TestHealthcheck tests the /healthcheck endpoint
 func TestHealthcheck(t *testing.T) {
-	router := setupRouter()
+	router := newTestRouter(t, "")
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/healthcheck", nil)
@@ -21,12 +71,9 @@ func TestHealthcheck(t *testing.T) {
 	assert.Equal(t, "still alive", w.Body.String())
 }
 
-// TestLogsEndpointWithoutKey tests /logs endpoint when LOGKEY is not set
+// TestLogsEndpointWithoutKey tests /logs endpoint when no key is configured
 func TestLogsEndpointWithoutKey(t *testing.T) {
-	// Ensure LOGKEY is not set
-	os.Unsetenv("LOGKEY")
-
-	router := setupRouter()
+	router := newTestRouter(t, "")
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/logs", nil)
@@ -38,11 +85,7 @@ func TestLogsEndpointWithoutKey(t *testing.T) {
 
 // TestLogsEndpointWithValidKey tests /logs endpoint with correct key
 func TestLogsEndpointWithValidKey(t *testing.T) {
-	// Set LOGKEY
-	os.Setenv("LOGKEY", "testkey123")
-	defer os.Unsetenv("LOGKEY")
-
-	router := setupRouter()
+	router := newTestRouter(t, "testkey123")
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/logs?key=testkey123", nil)
@@ -53,11 +96,7 @@ func TestLogsEndpointWithValidKey(t *testing.T) {
 
 // TestLogsEndpointWithInvalidKey tests /logs endpoint with incorrect key
 func TestLogsEndpointWithInvalidKey(t *testing.T) {
-	// Set LOGKEY
-	os.Setenv("LOGKEY", "correctkey")
-	defer os.Unsetenv("LOGKEY")
-
-	router := setupRouter()
+	router := newTestRouter(t, "correctkey")
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/logs?key=wrongkey", nil)
@@ -69,11 +108,7 @@ func TestLogsEndpointWithInvalidKey(t *testing.T) {
 
 // TestLogsEndpointWithMissingKey tests /logs endpoint when key is required but missing
 func TestLogsEndpointWithMissingKey(t *testing.T) {
-	// Set LOGKEY
-	os.Setenv("LOGKEY", "requiredkey")
-	defer os.Unsetenv("LOGKEY")
-
-	router := setupRouter()
+	router := newTestRouter(t, "requiredkey")
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/logs", nil)
@@ -85,9 +120,7 @@ func TestLogsEndpointWithMissingKey(t *testing.T) {
 
 // TestLogsEndpointWithCustomLines tests /logs endpoint with custom lines parameter
 func TestLogsEndpointWithCustomLines(t *testing.T) {
-	os.Unsetenv("LOGKEY")
-
-	router := setupRouter()
+	router := newTestRouter(t, "")
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/logs?lines=50", nil)
@@ -99,21 +132,32 @@ func TestLogsEndpointWithCustomLines(t *testing.T) {
 
 // TestLogsEndpointWithInvalidLinesParameter tests /logs with non-numeric lines param
 func TestLogsEndpointWithInvalidLinesParameter(t *testing.T) {
-	os.Unsetenv("LOGKEY")
-
-	router := setupRouter()
+	router := newTestRouter(t, "")
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/logs?lines=invalid", nil)
 	router.ServeHTTP(w, req)
 
-	// Should fall back to default (20 lines) and still succeed
-	assert.Equal(t, http.StatusOK, w.Code)
+	// Should reject the bad value instead of silently using the default
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid lines parameter")
+}
+
+// TestLogsEndpointWithConflictingSince tests /logs rejects sinceSeconds combined with sinceTime
+func TestLogsEndpointWithConflictingSince(t *testing.T) {
+	router := newTestRouter(t, "")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/logs?sinceSeconds=60&sinceTime=2025-01-01T00:00:00Z", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "mutually exclusive")
 }
 
 // TestVersionEndpoint tests the /version endpoint
 func TestVersionEndpoint(t *testing.T) {
-	router := setupRouter()
+	router := newTestRouter(t, "")
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/version", nil)
@@ -126,7 +170,7 @@ func TestVersionEndpoint(t *testing.T) {
 
 // TestUIEndpoint tests that the root / endpoint returns HTML
 func TestUIEndpoint(t *testing.T) {
-	router := setupRouter()
+	router := newTestRouter(t, "")
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/", nil)
@@ -136,3 +180,213 @@ func TestUIEndpoint(t *testing.T) {
 	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
 	assert.Contains(t, w.Body.String(), "k8s-simple-logs")
 }
+
+// TestAggregateLogsRequiresSelector tests that /ws/logs rejects requests without a selector
+func TestAggregateLogsRequiresSelector(t *testing.T) {
+	router := newTestRouter(t, "")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ws/logs", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "selector parameter is required")
+}
+
+// TestAggregateLogsInvalidSelector tests that /ws/logs rejects a malformed label selector
+func TestAggregateLogsInvalidSelector(t *testing.T) {
+	router := newTestRouter(t, "")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ws/logs?selector=app%3D%3D%3Dx", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid selector")
+}
+
+// TestContainersWatchWithInvalidKey tests /api/containers/watch rejects a wrong key before upgrading
+func TestContainersWatchWithInvalidKey(t *testing.T) {
+	router := newTestRouter(t, "correctkey")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/containers/watch?key=wrongkey", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid or missing API key")
+}
+
+// TestNamespacedContainersRejectsUnknownNamespace tests that namespaces outside the allow-list are refused
+func TestNamespacedContainersRejectsUnknownNamespace(t *testing.T) {
+	router := newTestRouter(t, "")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/namespaces/not-served/containers", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "is not served")
+}
+
+// TestContainersEndpoint tests that /api/containers lists every container of every pod
+func TestContainersEndpoint(t *testing.T) {
+	router := newTestRouter(t, "", testPod("web-1", "app", "proxy"), testPod("db-0", "postgres"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/containers", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Namespace  string         `json:"namespace"`
+		Containers []PodContainer `json:"containers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "default", body.Namespace)
+	var names []string
+	for _, c := range body.Containers {
+		names = append(names, c.PodName+"/"+c.ContainerName)
+		assert.Equal(t, "running", c.State)
+	}
+	assert.Equal(t, []string{"db-0/postgres", "web-1/app", "web-1/proxy"}, names)
+}
+
+// TestContainerLogsEndpoint tests /api/logs/:pod/:container
+func TestContainerLogsEndpoint(t *testing.T) {
+	router := newTestRouter(t, "", testPod("web-1", "app"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/logs/web-1/app?lines=10", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, map[string]string{"pod": "web-1", "container": "app", "logs": "fake logs"}, body)
+}
+
+// TestAPIAuthFailures tests that API endpoints reject a missing or wrong key and accept the header
+func TestAPIAuthFailures(t *testing.T) {
+	router := newTestRouter(t, "secret", testPod("web-1", "app"))
+
+	cases := []struct {
+		path   string
+		header string
+		code   int
+	}{
+		{"/api/containers", "", http.StatusForbidden},
+		{"/api/containers?key=wrong", "", http.StatusForbidden},
+		{"/api/containers", "wrong", http.StatusForbidden},
+		{"/api/containers", "secret", http.StatusOK},
+		{"/api/logs/web-1/app", "", http.StatusForbidden},
+		{"/api/logs/web-1/app?key=secret", "", http.StatusOK},
+		{"/api/namespaces", "", http.StatusForbidden},
+		// WebSockets take the header too; see TestWebSocketAuth for the rest
+		{"/ws/logs/web-1/app", "wrong", http.StatusForbidden},
+		// expvar would publish the command line, keys passed as flags included
+		{"/debug/vars", "secret", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tc.path, nil)
+		if tc.header != "" {
+			req.Header.Set("X-API-Key", tc.header)
+		}
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.code, w.Code, "%s with header %q", tc.path, tc.header)
+	}
+}
+
+// TestWebSocketLogStream tests that /ws/logs/:pod/:container streams log lines as JSON messages
+func TestWebSocketLogStream(t *testing.T) {
+	server := httptest.NewServer(newTestRouter(t, "secret", testPod("web-1", "app")))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/logs/web-1/app?key=secret"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var msg map[string]interface{}
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "fake logs", msg["log"])
+	assert.NotEmpty(t, msg["timestamp"])
+	assert.NotEmpty(t, msg["receivedAt"])
+}
+
+// TestWebSocketLogStreamRejectsBadKey tests that the upgrade is refused without the right key
+func TestWebSocketLogStreamRejectsBadKey(t *testing.T) {
+	server := httptest.NewServer(newTestRouter(t, "secret", testPod("web-1", "app")))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/logs/web-1/app?key=wrong"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+// TestLogsEndpointFormat tests the exact text layout of the legacy /logs endpoint
+func TestLogsEndpointFormat(t *testing.T) {
+	router := newTestRouter(t, "", testPod("web-1", "app", "proxy"), testPod("db-0", "postgres"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/logs", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	section := func(i, j int, pod, container string) string {
+		return "\n\n\n-----------------------------\n" +
+			fmt.Sprintf("ID: %d %d, \n Namespace: default \n Pod: %s:\n Container: %s\n", i, j, pod, container) +
+			"-----------------------------\n" +
+			"fake logs" +
+			"-----------------------------\n\n\n\n\n"
+	}
+	assert.Equal(t, section(0, 0, "db-0", "postgres")+section(1, 0, "web-1", "app")+section(1, 1, "web-1", "proxy"), w.Body.String())
+	assert.Equal(t, "[]", w.Header().Get(logErrorsTrailer))
+}
+
+// TestDisabledFeatures tests that switched off endpoints are not served
+func TestDisabledFeatures(t *testing.T) {
+	router := newTestRouterWith(t, func(opts *routerOptions) { opts.features = featuresConfig{} })
+
+	for _, path := range []string{"/", "/logs", "/api/logs/web-1/app/download", "/api/bundle", "/ws/logs?selector=app%3Dweb"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
+
+// TestKubernetesClientMergesKubeconfigs tests that a KUBECONFIG style list of files is merged like kubectl does
+func TestKubernetesClientMergesKubeconfigs(t *testing.T) {
+	dir := t.TempDir()
+	clusters := filepath.Join(dir, "clusters")
+	contexts := filepath.Join(dir, "contexts")
+	require.NoError(t, os.WriteFile(clusters, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+users:
+- name: dev
+  user:
+    token: dev-token
+`), 0o600))
+	require.NoError(t, os.WriteFile(contexts, []byte(`apiVersion: v1
+kind: Config
+current-context: dev
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+    namespace: team-a
+`), 0o600))
+
+	_, namespace, err := kubernetesClient(clusters+string(filepath.ListSeparator)+contexts, "")
+	require.NoError(t, err)
+	assert.Equal(t, "team-a", namespace)
+}
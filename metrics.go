@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+const metricsNamespace = "k8s_simple_logs"
+
+// Reasons counted by authFailures.
+const (
+	authFailureUnauthenticated = "unauthenticated"
+	authFailureForbidden       = "forbidden"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to serve HTTP requests by route and method. WebSockets are left out, they last as long as the stream.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	websocketConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "websocket_connections",
+		Help:      "Open WebSocket connections by route.",
+	}, []string{"route"})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_log_streams",
+		Help:      "Log streams open to the Kubernetes API.",
+	}, func() float64 { return float64(upstreamStreams.Load()) })
+	relayedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relayed_bytes_total",
+		Help:      "Log bytes read from the Kubernetes API by namespace, and by pod if enabled.",
+	}, []string{"namespace", "pod"})
+	relayedLines = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "relayed_lines_total",
+		Help:      "Log lines read from the Kubernetes API by namespace, and by pod if enabled.",
+	}, []string{"namespace", "pod"})
+	kubeRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "kubernetes_request_duration_seconds",
+		Help:      "Kubernetes API request latency by verb and resource.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"verb", "resource"})
+	kubeRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "kubernetes_requests_total",
+		Help:      "Kubernetes API requests by method and status code; code is <error> when no response came back.",
+	}, []string{"method", "code"})
+	authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_failures_total",
+		Help:      "Requests refused for missing or invalid credentials (unauthenticated) or for lack of access (forbidden).",
+	}, []string{"reason"})
+)
+
+func init() {
+	// client-go reports every API call through these hooks
+	clientmetrics.Register(clientmetrics.RegisterOpts{
+		RequestLatency: kubeLatencyMetric{},
+		RequestResult:  kubeResultMetric{},
+	})
+}
+
+type kubeLatencyMetric struct{}
+
+func (kubeLatencyMetric) Observe(_ context.Context, verb string, u url.URL, latency time.Duration) {
+	kubeRequestDuration.WithLabelValues(verb, apiResource(u.Path)).Observe(latency.Seconds())
+}
+
+type kubeResultMetric struct{}
+
+func (kubeResultMetric) Increment(_ context.Context, code, method, _ string) {
+	kubeRequests.WithLabelValues(method, code).Inc()
+}
+
+// apiResource reduces a Kubernetes API path to its resource and
+// subresource, e.g. /api/v1/namespaces/default/pods/web-1/log to
+// "pods/log", so names don't end up in metric labels.
+func apiResource(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		return "other"
+	}
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		parts = parts[2:]
+	}
+	switch len(parts) {
+	case 0:
+		return "discovery"
+	case 1, 2:
+		return parts[0]
+	default:
+		return parts[0] + "/" + parts[2]
+	}
+}
+
+// relayPodLabels is set from features.metricsPodLabels. Pod names are left
+// out of the relayed metrics unless it is: /metrics is open, and they add
+// series with every pod that comes and goes.
+var relayPodLabels atomic.Bool
+
+// logStreamLabels returns the namespace and, if relayPodLabels is set, the
+// pod of a pod log request.
+func logStreamLabels(u *url.URL) (namespace, pod string) {
+	// /api/v1/namespaces/<namespace>/pods/<pod>/log
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 7 || parts[2] != "namespaces" || parts[4] != "pods" {
+		return "", ""
+	}
+	if relayPodLabels.Load() {
+		return parts[3], parts[5]
+	}
+	return parts[3], ""
+}
+
+// relayCounter counts what is read from one log stream.
+type relayCounter struct {
+	bytes prometheus.Counter
+	lines prometheus.Counter
+}
+
+func newRelayCounter(namespace, pod string) *relayCounter {
+	return &relayCounter{
+		bytes: relayedBytes.WithLabelValues(namespace, pod),
+		lines: relayedLines.WithLabelValues(namespace, pod),
+	}
+}
+
+func (r *relayCounter) add(p []byte) {
+	r.bytes.Add(float64(len(p)))
+	r.lines.Add(float64(bytes.Count(p, []byte{'\n'})))
+}
+
+// metricsMiddleware counts requests and their latency by route.
+func metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	code := c.Writer.Status()
+	if c.IsWebsocket() && code == http.StatusOK {
+		code = http.StatusSwitchingProtocols
+	}
+	httpRequests.WithLabelValues(route, c.Request.Method, strconv.Itoa(code)).Inc()
+	if code != http.StatusSwitchingProtocols {
+		httpDuration.WithLabelValues(route, c.Request.Method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// metricsHandler serves the Prometheus metrics.
+func metricsHandler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
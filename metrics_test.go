@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMetrics tests that requests, relayed logs, WebSockets and auth failures are counted
+func TestMetrics(t *testing.T) {
+	router := newTestRouter(t, "secret", testPod("metrics-1", "app"))
+	route := "/api/logs/:pod/:container"
+	served := testutil.ToFloat64(httpRequests.WithLabelValues(route, "GET", "200"))
+	denied := testutil.ToFloat64(authFailures.WithLabelValues(authFailureUnauthenticated))
+	relayed := testutil.ToFloat64(relayedBytes.WithLabelValues("default", ""))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/logs/metrics-1/app?key=secret", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/logs/metrics-1/app?key=wrong", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.Equal(t, served+1, testutil.ToFloat64(httpRequests.WithLabelValues(route, "GET", "200")))
+	assert.Equal(t, denied+1, testutil.ToFloat64(authFailures.WithLabelValues(authFailureUnauthenticated)))
+	assert.Equal(t, relayed+float64(len("fake logs")), testutil.ToFloat64(relayedBytes.WithLabelValues("default", "")))
+
+	// Open WebSockets are tracked per route
+	server := httptest.NewServer(router)
+	defer server.Close()
+	wsRoute := "/api/containers/watch"
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/containers/watch?key=secret", nil)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(websocketConnections.WithLabelValues(wsRoute)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	conn.Close()
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(websocketConnections.WithLabelValues(wsRoute)) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// /metrics needs no key
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `k8s_simple_logs_relayed_lines_total{namespace="default",pod=""}`)
+	assert.Contains(t, w.Body.String(), "k8s_simple_logs_upstream_log_streams")
+}
+
+// TestMetricsPodLabels tests that relayed logs are counted by pod only when enabled
+func TestMetricsPodLabels(t *testing.T) {
+	router := newTestRouterWith(t, func(opts *routerOptions) { opts.features.MetricsPodLabels = true }, testPod("metrics-2", "app"))
+	relayed := testutil.ToFloat64(relayedBytes.WithLabelValues("default", "metrics-2"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/logs/metrics-2/app", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, relayed+float64(len("fake logs")), testutil.ToFloat64(relayedBytes.WithLabelValues("default", "metrics-2")))
+
+	u := &url.URL{Path: "/api/v1/namespaces/default/pods/metrics-2/log"}
+	relayPodLabels.Store(false)
+	namespace, pod := logStreamLabels(u)
+	assert.Equal(t, "default", namespace)
+	assert.Empty(t, pod)
+}
+
+// TestAPIResource tests that API paths are reduced to resources without names
+func TestAPIResource(t *testing.T) {
+	cases := map[string]string{
+		"/api/v1/namespaces/default/pods/web-1/log":              "pods/log",
+		"/api/v1/namespaces/default/pods":                        "pods",
+		"/api/v1/namespaces":                                     "namespaces",
+		"/api/v1/namespaces/default":                             "namespaces",
+		"/apis/authorization.k8s.io/v1/subjectaccessreviews":     "subjectaccessreviews",
+		"/apis/apps/v1/namespaces/default/deployments/web/scale": "deployments/scale",
+		"/api":     "other",
+		"/version": "other",
+	}
+	for path, want := range cases {
+		assert.Equal(t, want, apiResource(path), path)
+	}
+}
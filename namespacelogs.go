@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// namespaceLogsWorkers bounds how many containers /logs fetches at once.
+// Fetched logs are held until their turn to be written, so this also caps
+// how many containers' logs are in memory.
+const namespaceLogsWorkers = 4
+
+// logErrorsTrailer is the HTTP trailer in which /logs reports the containers
+// whose logs couldn't be fetched, as a JSON array of containerLogError.
+const logErrorsTrailer = "X-Log-Errors"
+
+// containerLogs is the outcome of fetching one container's logs for /logs.
+// PodIndex and ContainerIndex number the section as the output always has.
+type containerLogs struct {
+	PodIndex       int
+	ContainerIndex int
+	Pod            string
+	Container      string
+	Logs           []byte
+	Err            error
+}
+
+// fetchNamespaceLogs fetches the logs of every container in podList with up
+// to workers requests in flight, and hands the results to emit in pod and
+// container order. A worker slot is only freed once its result has been
+// emitted, so a slow container early in the list holds back later fetches
+// rather than letting finished logs pile up. Fetching stops at the first
+// error returned by emit, which is returned.
+func fetchNamespaceLogs(ctx context.Context, clientset kubernetes.Interface, namespace string, podList []*corev1.Pod, baseOpts *corev1.PodLogOptions, filter *lineFilter, workers int, emit func(containerLogs) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var jobs []containerLogs
+	for i, pod := range podList {
+		for j, container := range pod.Spec.Containers {
+			jobs = append(jobs, containerLogs{PodIndex: i, ContainerIndex: j, Pod: pod.Name, Container: container.Name})
+		}
+	}
+
+	results := make([]chan containerLogs, len(jobs))
+	for i := range results {
+		results[i] = make(chan containerLogs, 1)
+	}
+	slots := make(chan struct{}, workers)
+
+	go func() {
+		for i, job := range jobs {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(i int, job containerLogs) {
+				opts := *baseOpts
+				opts.Container = job.Container
+				job.Logs, job.Err = fetchContainerLogs(ctx, clientset, namespace, job.Pod, &opts, filter)
+				results[i] <- job
+			}(i, job)
+		}
+	}()
+
+	for i := range jobs {
+		var result containerLogs
+		select {
+		case result = <-results[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		err := emit(result)
+		<-slots
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchContainerLogs reads one container's logs, filtered, into memory.
+func fetchContainerLogs(ctx context.Context, clientset kubernetes.Interface, namespace, pod string, opts *corev1.PodLogOptions, filter *lineFilter) ([]byte, error) {
+	logStream, err := openLogStream(ctx, clientset.CoreV1().Pods(namespace).GetLogs(pod, opts))
+	if err != nil {
+		return nil, err
+	}
+	defer logStream.Close()
+
+	var buf bytes.Buffer
+	if err := copyFiltered(&buf, logStream, filter); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeLogsSection writes one container's block of the /logs output. The
+// layout, odd spacing included, is relied on by existing scripts and must
+// not change. A container whose logs couldn't be fetched gets an ERROR line
+// in place of its logs.
+func writeLogsSection(w io.Writer, namespace string, result containerLogs) error {
+	header := "\n\n\n-----------------------------\n" +
+		fmt.Sprintf("ID: %d %d, \n Namespace: %s \n Pod: %s:\n Container: %s\n", result.PodIndex, result.ContainerIndex, namespace, result.Pod, result.Container) +
+		"-----------------------------\n"
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	if result.Err != nil {
+		if _, err := fmt.Fprintf(w, "ERROR: %v\n", result.Err); err != nil {
+			return err
+		}
+	} else if _, err := w.Write(result.Logs); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "-----------------------------\n\n\n\n\n")
+	return err
+}
+
+// containerLogError describes a container whose logs couldn't be fetched.
+type containerLogError struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Error     string `json:"error"`
+}
+
+// containerLogsEntry is one container in the /api/logs/all response.
+type containerLogsEntry struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Logs      string `json:"logs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// allLogsHandler is the JSON counterpart of /logs: every container's logs in
+// the namespace, each with an error field when its logs couldn't be fetched.
+// The response is encoded one container at a time as results arrive, so
+// like /logs it never holds the whole namespace in memory:
+//
+//	{"namespace":"...","containers":[{"pod":"...","container":"...","logs":"...","error":"..."}],"errors":1}
+func allLogsHandler(clientset kubernetes.Interface, namespaces *namespaceRegistry, limits tailLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		namespace := c.GetString("namespace")
+
+		baseLogOpts, err := logOptionsFromQuery(c, "", limits)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter, err := lineFilterFromQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		pods := namespaces.cache(namespace)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cacheSyncTimeout)
+		err = pods.waitForSync(ctx)
+		cancel()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		podList, err := pods.list(labels.Everything())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		ns, _ := json.Marshal(namespace)
+		fmt.Fprintf(c.Writer, `{"namespace":%s,"containers":[`, ns)
+
+		errorCount := 0
+		first := true
+		err = fetchNamespaceLogs(c.Request.Context(), clientset, namespace, podList, baseLogOpts, filter, namespaceLogsWorkers, func(result containerLogs) error {
+			entry := containerLogsEntry{Pod: result.Pod, Container: result.Container, Logs: string(result.Logs)}
+			if result.Err != nil {
+				entry.Error = result.Err.Error()
+				errorCount++
+			}
+			b, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if !first {
+				b = append([]byte(","), b...)
+			}
+			first = false
+			if _, err := c.Writer.Write(b); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			return nil
+		})
+		if err != nil {
+			// Too late to change the status; leave the JSON unterminated so
+			// clients notice the response is incomplete.
+			fmt.Printf("/api/logs/all stopped early: %v\n", err)
+			return
+		}
+		fmt.Fprintf(c.Writer, `],"errors":%d}`, errorCount)
+	}
+}
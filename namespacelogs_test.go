@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testPods(containers map[string][]string, order ...string) []*corev1.Pod {
+	var pods []*corev1.Pod
+	for _, name := range order {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		for _, container := range containers[name] {
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: container})
+		}
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+// TestFetchNamespaceLogsPreservesOrder tests that results are emitted in pod and container order
+func TestFetchNamespaceLogsPreservesOrder(t *testing.T) {
+	pods := testPods(map[string][]string{
+		"a": {"app", "proxy"},
+		"b": {"app"},
+		"c": {"app", "proxy", "init"},
+	}, "a", "b", "c")
+
+	var got []string
+	err := fetchNamespaceLogs(context.Background(), fake.NewSimpleClientset(), "default", pods, &corev1.PodLogOptions{}, nil, 2, func(result containerLogs) error {
+		require.NoError(t, result.Err)
+		assert.Equal(t, "fake logs", string(result.Logs))
+		got = append(got, result.Pod+"/"+result.Container)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/app", "a/proxy", "b/app", "c/app", "c/proxy", "c/init"}, got)
+}
+
+// TestFetchNamespaceLogsStopsOnEmitError tests that an emit failure ends the fetch
+func TestFetchNamespaceLogsStopsOnEmitError(t *testing.T) {
+	pods := testPods(map[string][]string{"a": {"app", "proxy"}, "b": {"app"}}, "a", "b")
+	stop := errors.New("client went away")
+
+	calls := 0
+	err := fetchNamespaceLogs(context.Background(), fake.NewSimpleClientset(), "default", pods, &corev1.PodLogOptions{}, nil, 1, func(containerLogs) error {
+		calls++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, calls)
+}
+
+// TestWriteLogsSection tests that the /logs section layout is unchanged
+func TestWriteLogsSection(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeLogsSection(&buf, "default", containerLogs{PodIndex: 1, ContainerIndex: 0, Pod: "web-1", Container: "app", Logs: []byte("hello\n")}))
+
+	assert.Equal(t, "\n\n\n-----------------------------\n"+
+		"ID: 1 0, \n Namespace: default \n Pod: web-1:\n Container: app\n"+
+		"-----------------------------\n"+
+		"hello\n"+
+		"-----------------------------\n\n\n\n\n", buf.String())
+}
+
+// TestWriteLogsSectionError tests that a failed container gets an error line in its section
+func TestWriteLogsSectionError(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeLogsSection(&buf, "default", containerLogs{Pod: "web-1", Container: "app", Err: errors.New("container is waiting to start")}))
+
+	assert.Contains(t, buf.String(), " Container: app\n-----------------------------\nERROR: container is waiting to start\n-----------------------------\n")
+}
+
+// TestAllLogsHandler tests the JSON variant of /logs
+func TestAllLogsHandler(t *testing.T) {
+	pods := testPods(map[string][]string{"a": {"app", "proxy"}, "b": {"app"}}, "a", "b")
+	clientset := fake.NewSimpleClientset(pods[0], pods[1])
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	namespaces := newNamespaceRegistry(clientset, "default", "", stopCh)
+
+	r := gin.New()
+	r.GET("/api/logs/all", namespaceMiddleware(namespaces), allLogsHandler(clientset, namespaces, tailLimits{defaultLines: 100}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/logs/all", nil)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Namespace  string               `json:"namespace"`
+		Containers []containerLogsEntry `json:"containers"`
+		Errors     int                  `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "default", body.Namespace)
+	assert.Equal(t, 0, body.Errors)
+	assert.Equal(t, []containerLogsEntry{
+		{Pod: "a", Container: "app", Logs: "fake logs"},
+		{Pod: "a", Container: "proxy", Logs: "fake logs"},
+		{Pod: "b", Container: "app", Logs: "fake logs"},
+	}, body.Containers)
+}
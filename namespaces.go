@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// allNamespaces is the NAMESPACES value that serves every namespace in the
+// cluster. It needs a ClusterRole rather than a Role.
+const allNamespaces = "*"
+
+// namespaceRegistry decides which namespaces the server may serve and keeps
+// one pod cache per namespace, started the first time it is requested. When
+// every namespace is served, the caches share one informer watching pods in
+// all of them, so requests can't start watches at will.
+type namespaceRegistry struct {
+	clientset        kubernetes.Interface
+	defaultNamespace string
+	// all is set when every namespace is served; otherwise allowed holds
+	// the allow-list, which always includes the default namespace.
+	all     bool
+	allowed []string
+	stopCh  <-chan struct{}
+
+	mu     sync.Mutex
+	caches map[string]*podCache
+	// cluster is the informer for every namespace, started on first use
+	// when all is set.
+	cluster *podCache
+}
+
+// newNamespaceRegistry builds a registry from the NAMESPACES setting: empty
+// for just the default namespace, a comma separated allow-list, or "*".
+func newNamespaceRegistry(clientset kubernetes.Interface, defaultNamespace, spec string, stopCh <-chan struct{}) *namespaceRegistry {
+	n := &namespaceRegistry{
+		clientset:        clientset,
+		defaultNamespace: defaultNamespace,
+		stopCh:           stopCh,
+		caches:           map[string]*podCache{},
+	}
+
+	seen := map[string]bool{defaultNamespace: true}
+	n.allowed = []string{defaultNamespace}
+	for _, ns := range strings.Split(spec, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == allNamespaces {
+			n.all = true
+			continue
+		}
+		if ns != "" && !seen[ns] {
+			seen[ns] = true
+			n.allowed = append(n.allowed, ns)
+		}
+	}
+	sort.Strings(n.allowed)
+	return n
+}
+
+// allows reports whether ns may be served.
+func (n *namespaceRegistry) allows(ns string) bool {
+	if n.all {
+		return true
+	}
+	for _, allowed := range n.allowed {
+		if allowed == ns {
+			return true
+		}
+	}
+	return false
+}
+
+// exists reports whether ns is a namespace of the cluster. Only names taken
+// from requests in "*" mode need checking; the allow-list is trusted.
+func (n *namespaceRegistry) exists(ctx context.Context, ns string) (bool, error) {
+	if !n.all || ns == n.defaultNamespace {
+		return true, nil
+	}
+	n.mu.Lock()
+	_, known := n.caches[ns]
+	n.mu.Unlock()
+	if known {
+		return true, nil
+	}
+	_, err := n.clientset.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// cache returns the pod cache for ns, starting its informer on first use.
+// Callers must check allows, and exists, first.
+func (n *namespaceRegistry) cache(ns string) *podCache {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	pods, ok := n.caches[ns]
+	if !ok {
+		if n.all {
+			if n.cluster == nil {
+				n.cluster = newPodCache(n.clientset, metav1.NamespaceAll)
+				n.cluster.start(n.stopCh)
+			}
+			pods = n.cluster.view(ns)
+		} else {
+			pods = newPodCache(n.clientset, ns)
+			pods.start(n.stopCh)
+		}
+		n.caches[ns] = pods
+	}
+	return pods
+}
+
+// list returns the namespaces that can be served, asking the API server
+// when every namespace is allowed.
+func (n *namespaceRegistry) list(ctx context.Context) ([]string, error) {
+	if !n.all {
+		return n.allowed, nil
+	}
+	list, err := n.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	namespaces := []string{}
+	for _, ns := range list.Items {
+		namespaces = append(namespaces, ns.Name)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// namespaceMiddleware resolves the namespace for a request from the :ns
+// route parameter, falling back to the default namespace for the original
+// unprefixed routes, and rejects namespaces outside the allow-list or, when
+// every namespace is served, that don't exist. The result is stored in the
+// context under "namespace".
+func namespaceMiddleware(namespaces *namespaceRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ns := c.Param("ns")
+		if ns == "" {
+			ns = namespaces.defaultNamespace
+		}
+		if !namespaces.allows(ns) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("namespace %q is not served by this instance", ns)})
+			c.Abort()
+			return
+		}
+		exists, err := namespaces.exists(c.Request.Context(), ns)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("namespace %q not found", ns)})
+			c.Abort()
+			return
+		}
+		c.Set("namespace", ns)
+		c.Next()
+	}
+}
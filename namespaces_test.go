@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestNamespaceRegistryAllowList tests parsing of a comma separated NAMESPACES value
+func TestNamespaceRegistryAllowList(t *testing.T) {
+	namespaces := newNamespaceRegistry(fake.NewSimpleClientset(), "default", " team-b, team-a,,default ", nil)
+
+	assert.False(t, namespaces.all)
+	assert.Equal(t, []string{"default", "team-a", "team-b"}, namespaces.allowed)
+	assert.True(t, namespaces.allows("team-a"))
+	assert.False(t, namespaces.allows("kube-system"))
+}
+
+// TestNamespaceRegistryAll tests that "*" allows and lists every namespace in the cluster
+func TestNamespaceRegistryAll(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "zeta"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "alpha"}},
+	)
+	namespaces := newNamespaceRegistry(clientset, "default", "*", nil)
+
+	assert.True(t, namespaces.allows("kube-system"))
+	list, err := namespaces.list(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alpha", "zeta"}, list)
+}
+
+// TestNamespaceMiddleware tests namespace resolution and rejection of namespaces outside the allow-list
+func TestNamespaceMiddleware(t *testing.T) {
+	namespaces := newNamespaceRegistry(fake.NewSimpleClientset(), "default", "team-a", nil)
+
+	r := gin.New()
+	handler := func(c *gin.Context) { c.String(http.StatusOK, c.GetString("namespace")) }
+	r.GET("/api/containers", namespaceMiddleware(namespaces), handler)
+	r.GET("/api/namespaces/:ns/containers", namespaceMiddleware(namespaces), handler)
+
+	cases := map[string]struct {
+		code int
+		body string
+	}{
+		"/api/containers":                        {http.StatusOK, "default"},
+		"/api/namespaces/team-a/containers":      {http.StatusOK, "team-a"},
+		"/api/namespaces/kube-system/containers": {http.StatusForbidden, "is not served"},
+	}
+	for path, want := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, want.code, w.Code, path)
+		assert.Contains(t, w.Body.String(), want.body, path)
+	}
+}
+
+// TestNamespaceRegistryAllChecksExistence tests that "*" serves existing namespaces from one shared informer and refuses unknown ones
+func TestNamespaceRegistryAllChecksExistence(t *testing.T) {
+	teamA := testPod("web-1", "app")
+	teamA.Namespace = "team-a"
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+		teamA,
+		testPod("db-1", "postgres"),
+	)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	namespaces := newNamespaceRegistry(clientset, "default", "*", stopCh)
+
+	r := gin.New()
+	r.GET("/api/namespaces/:ns/containers", namespaceMiddleware(namespaces), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("namespace"))
+	})
+	cases := map[string]int{
+		"/api/namespaces/team-a/containers":  http.StatusOK,
+		"/api/namespaces/default/containers": http.StatusOK,
+		"/api/namespaces/no-such/containers": http.StatusNotFound,
+	}
+	for path, want := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, path)
+	}
+
+	a, b := namespaces.cache("team-a"), namespaces.cache("team-b")
+	assert.Same(t, a.informer, b.informer, "one informer for every namespace")
+	require.NoError(t, a.waitForSync(context.Background()))
+	pods, err := a.list(labels.Everything())
+	require.NoError(t, err)
+	require.Len(t, pods, 1)
+	assert.Equal(t, "team-a", pods[0].Namespace)
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+// Cookies set by the OIDC login. The login cookie carries the state, nonce
+// and PKCE verifier from /login to the callback; the session cookie holds
+// the signed-in user.
+const (
+	sessionCookie      = "k8s_simple_logs_session"
+	loginCookie        = "k8s_simple_logs_login"
+	loginCookieMaxAge  = 10 * time.Minute
+	oidcCallbackPath   = "/login/callback"
+	oidcDiscoveryLimit = 10 * time.Second
+)
+
+// userKey is the gin context key holding the signed-in user's name.
+const userKey = "user"
+
+// oidcAuth signs users in with an OpenID Connect provider using the
+// authorization code flow and keeps them signed in with an HMAC-signed
+// session cookie, so no server-side session store is needed.
+type oidcAuth struct {
+	oauth2    oauth2.Config
+	verifier  *oidc.IDTokenVerifier
+	secret    []byte
+	maxAge    time.Duration
+	logoutURL string
+}
+
+// session is the content of the session cookie.
+type session struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Expires int64  `json:"exp"`
+}
+
+// user is how the session is shown in logs and to the UI.
+func (s session) user() string {
+	if s.Email != "" {
+		return s.Email
+	}
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Subject
+}
+
+// loginState is the content of the login cookie.
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect"`
+	Expires  int64  `json:"exp"`
+}
+
+// newOIDCAuth discovers the provider at cfg.IssuerURL. Without a session
+// secret a random one is used, so sessions end when the server restarts
+// and aren't shared between replicas.
+func newOIDCAuth(ctx context.Context, cfg oidcConfig) (*oidcAuth, error) {
+	ctx, cancel := context.WithTimeout(ctx, oidcDiscoveryLimit)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("discovering OIDC provider: %v", err)
+	}
+
+	scopes := cfg.Scopes
+	hasOpenID := false
+	for _, scope := range scopes {
+		hasOpenID = hasOpenID || scope == oidc.ScopeOpenID
+	}
+	if !hasOpenID {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	secret := []byte(cfg.SessionSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	// Providers that support RP-initiated logout advertise where to send
+	// the browser; without it /logout only ends the local session.
+	var metadata struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	provider.Claims(&metadata)
+
+	return &oidcAuth{
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier:  provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		secret:    secret,
+		maxAge:    time.Duration(cfg.SessionMaxAgeSeconds) * time.Second,
+		logoutURL: metadata.EndSessionEndpoint,
+	}, nil
+}
+
+// sign returns v as base64 JSON followed by its HMAC. The HMAC covers the
+// name of the cookie the value is for, so one cookie can't be passed off as
+// another.
+func (a *oidcAuth) sign(cookie string, v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(a.mac(cookie, encoded)), nil
+}
+
+func (a *oidcAuth) mac(cookie, encoded string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(cookie + "." + encoded))
+	return mac.Sum(nil)
+}
+
+// verify checks a value made by sign for cookie and decodes it into v.
+func (a *oidcAuth) verify(cookie, value string, v interface{}) error {
+	encoded, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return errors.New("malformed cookie")
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return errors.New("malformed cookie")
+	}
+	if !hmac.Equal(got, a.mac(cookie, encoded)) {
+		return errors.New("bad cookie signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return errors.New("malformed cookie")
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// session returns the signed-in user of the request, if any.
+func (a *oidcAuth) session(r *http.Request) (session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return session{}, false
+	}
+	var s session
+	if err := a.verify(sessionCookie, cookie.Value, &s); err != nil || s.Subject == "" || time.Now().Unix() >= s.Expires {
+		return session{}, false
+	}
+	return s, true
+}
+
+// setCookie sets a cookie scoped to the whole site that scripts can't read.
+// SameSite=Lax lets the provider's redirect back carry the login cookie.
+func setCookie(c *gin.Context, name, value string, maxAge time.Duration) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge / time.Second),
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearCookie(c *gin.Context, name string) {
+	setCookie(c, name, "", -time.Second)
+}
+
+// localRedirect returns target if it is a path on this server, or "/", so
+// /login can't be used to send users elsewhere.
+func localRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// loginHandler serves /login?redirect=/path, sending the browser to the
+// provider. The callback returns it to redirect once signed in.
+func (a *oidcAuth) loginHandler(c *gin.Context) {
+	target, err := a.startLogin(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Redirect(http.StatusFound, target)
+}
+
+// startLogin sets the login cookie and returns the provider URL to send
+// the browser to.
+func (a *oidcAuth) startLogin(c *gin.Context) (string, error) {
+	state, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	login := loginState{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+		Redirect: localRedirect(c.Query("redirect")),
+		Expires:  time.Now().Add(loginCookieMaxAge).Unix(),
+	}
+	value, err := a.sign(loginCookie, login)
+	if err != nil {
+		return "", err
+	}
+	setCookie(c, loginCookie, value, loginCookieMaxAge)
+	return a.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(login.Verifier)), nil
+}
+
+// callbackHandler serves the redirect back from the provider: it checks
+// the state, exchanges the code, verifies the ID token and starts a session.
+func (a *oidcAuth) callbackHandler(c *gin.Context) {
+	if errParam := c.Query("error"); errParam != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("login failed: %s %s", errParam, c.Query("error_description"))})
+		return
+	}
+
+	cookie, err := c.Cookie(loginCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no login in progress, start again at /login"})
+		return
+	}
+	clearCookie(c, loginCookie)
+	var login loginState
+	if err := a.verify(loginCookie, cookie, &login); err != nil || time.Now().Unix() >= login.Expires {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login expired, start again at /login"})
+		return
+	}
+	if c.Query("state") != login.State {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login state mismatch, start again at /login"})
+		return
+	}
+
+	token, err := a.oauth2.Exchange(c.Request.Context(), c.Query("code"), oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("exchanging authorization code: %v", err)})
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "provider returned no ID token"})
+		return
+	}
+	idToken, err := a.verifier.Verify(c.Request.Context(), rawIDToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("invalid ID token: %v", err)})
+		return
+	}
+	if idToken.Nonce != login.Nonce {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "ID token nonce mismatch"})
+		return
+	}
+	var claims struct {
+		Email string `json:"email"`
+		Name  string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("invalid ID token claims: %v", err)})
+		return
+	}
+
+	s := session{
+		Subject: idToken.Subject,
+		Email:   claims.Email,
+		Name:    claims.Name,
+		Expires: time.Now().Add(a.maxAge).Unix(),
+	}
+	value, err := a.sign(sessionCookie, s)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setCookie(c, sessionCookie, value, a.maxAge)
+	fmt.Println("OIDC login:", s.user())
+	c.Redirect(http.StatusFound, login.Redirect)
+}
+
+// logoutHandler serves /logout, ending the session and, if the provider
+// supports it, the provider's session too.
+func (a *oidcAuth) logoutHandler(c *gin.Context) {
+	clearCookie(c, sessionCookie)
+	if a.logoutURL == "" {
+		c.Redirect(http.StatusFound, "/")
+		return
+	}
+	target, err := url.Parse(a.logoutURL)
+	if err != nil {
+		c.Redirect(http.StatusFound, "/")
+		return
+	}
+	query := target.Query()
+	query.Set("client_id", a.oauth2.ClientID)
+	target.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, target.String())
+}
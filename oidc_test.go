@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockProvider is a minimal OpenID Connect provider that signs in anyone
+// who reaches /authorize as alice@example.com.
+type mockProvider struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu     sync.Mutex
+	nonces map[string]string // authorization code -> nonce
+}
+
+func newMockProvider(t *testing.T, clientID string) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p := &mockProvider{key: key, clientID: clientID, nonces: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/keys",
+			"end_session_endpoint":                  p.URL + "/logout",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		code, _ := randomString()
+		p.mu.Lock()
+		p.nonces[code] = query.Get("nonce")
+		p.mu.Unlock()
+		redirect, _ := url.Parse(query.Get("redirect_uri"))
+		back := redirect.Query()
+		back.Set("code", code)
+		back.Set("state", query.Get("state"))
+		redirect.RawQuery = back.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		p.mu.Lock()
+		nonce, ok := p.nonces[r.Form.Get("code")]
+		delete(p.nonces, r.Form.Get("code"))
+		p.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token": p.idToken(t, map[string]interface{}{
+				"iss":   p.URL,
+				"sub":   "alice-id",
+				"aud":   p.clientID,
+				"iat":   time.Now().Unix(),
+				"exp":   time.Now().Add(time.Hour).Unix(),
+				"nonce": nonce,
+				"email": "alice@example.com",
+			}),
+		})
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("signed out"))
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// idToken signs claims as an RS256 JWT.
+func (p *mockProvider) idToken(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// newOIDCTestServer starts the router with OIDC sign-in against provider.
+func newOIDCTestServer(t *testing.T, provider *mockProvider) *httptest.Server {
+	var handler http.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	auth, err := newOIDCAuth(context.Background(), oidcConfig{
+		IssuerURL:            provider.URL,
+		ClientID:             provider.clientID,
+		ClientSecret:         "client-secret",
+		RedirectURL:          server.URL + oidcCallbackPath,
+		Scopes:               []string{"email"},
+		SessionMaxAgeSeconds: 3600,
+	})
+	require.NoError(t, err)
+
+	handler = newTestRouterWith(t, func(opts *routerOptions) { opts.oidc = auth }, testPod("web-1", "app"))
+	return server
+}
+
+func cookieClient(t *testing.T) *http.Client {
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	return &http.Client{Jar: jar}
+}
+
+// TestOIDCLogin tests the authorization code flow end to end against a mock provider
+func TestOIDCLogin(t *testing.T) {
+	provider := newMockProvider(t, "k8s-simple-logs")
+	server := newOIDCTestServer(t, provider)
+	client := cookieClient(t)
+
+	// Not signed in: the API asks for sign-in and the UI redirects to it
+	resp, err := client.Get(server.URL + "/api/containers")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = noRedirects.Get(server.URL + "/?pod=web-1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/login?redirect=%2F%3Fpod%3Dweb-1", resp.Header.Get("Location"))
+
+	// Sign in, landing on the page asked for
+	resp, err = client.Get(server.URL + "/login?redirect=/api/session")
+	require.NoError(t, err)
+	var sess map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&sess))
+	resp.Body.Close()
+	assert.Equal(t, server.URL+"/api/session", resp.Request.URL.String())
+	assert.Equal(t, "alice@example.com", sess["user"])
+	assert.Equal(t, "/logout", sess["logout"])
+
+	// The session opens the API and WebSockets
+	resp, err = client.Get(server.URL + "/api/containers")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	dialer := websocket.Dialer{Jar: client.Jar}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/logs/web-1/app", nil)
+	require.NoError(t, err)
+	var msg map[string]interface{}
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "fake logs", msg["log"])
+	conn.Close()
+
+	// Signing out ends the session here and at the provider
+	resp, err = client.Get(server.URL + "/logout")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.True(t, strings.HasPrefix(resp.Request.URL.String(), provider.URL+"/logout?client_id=k8s-simple-logs"))
+	resp, err = client.Get(server.URL + "/api/containers")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// TestOIDCCallbackRejectsForgedRequests tests that the callback needs the login cookie and matching state
+func TestOIDCCallbackRejectsForgedRequests(t *testing.T) {
+	provider := newMockProvider(t, "k8s-simple-logs")
+	server := newOIDCTestServer(t, provider)
+
+	resp, err := http.Get(server.URL + oidcCallbackPath + "?code=abc&state=xyz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "no login cookie")
+
+	// Start a login but come back with another state
+	client := cookieClient(t)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err = client.Get(server.URL + "/login")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	resp, err = client.Get(server.URL + oidcCallbackPath + "?code=abc&state=forged")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+// TestOIDCSessionCookie tests that tampered and expired session cookies are refused
+func TestOIDCSessionCookie(t *testing.T) {
+	auth := &oidcAuth{secret: []byte("secret")}
+	request := func(value string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+		return r
+	}
+
+	valid, err := auth.sign(sessionCookie, session{Subject: "alice-id", Expires: time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	s, ok := auth.session(request(valid))
+	require.True(t, ok)
+	assert.Equal(t, "alice-id", s.user())
+
+	forged, _ := json.Marshal(session{Subject: "mallory", Expires: time.Now().Add(time.Hour).Unix()})
+	_, sig, _ := strings.Cut(valid, ".")
+	_, ok = auth.session(request(base64.RawURLEncoding.EncodeToString(forged) + "." + sig))
+	assert.False(t, ok, "tampered payload")
+
+	expired, err := auth.sign(sessionCookie, session{Subject: "alice-id", Expires: time.Now().Add(-time.Second).Unix()})
+	require.NoError(t, err)
+	_, ok = auth.session(request(expired))
+	assert.False(t, ok, "expired")
+
+	other := &oidcAuth{secret: []byte("other")}
+	_, ok = other.session(request(valid))
+	assert.False(t, ok, "signed with another secret")
+
+	anonymous, err := auth.sign(sessionCookie, session{Expires: time.Now().Add(time.Hour).Unix()})
+	require.NoError(t, err)
+	_, ok = auth.session(request(anonymous))
+	assert.False(t, ok, "no subject")
+}
+
+// TestOIDCLoginCookieIsNotASession tests that the login cookie from /login can't be used as a session cookie
+func TestOIDCLoginCookieIsNotASession(t *testing.T) {
+	provider := newMockProvider(t, "k8s-simple-logs")
+	server := newOIDCTestServer(t, provider)
+
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirects.Get(server.URL + "/login")
+	require.NoError(t, err)
+	resp.Body.Close()
+	var login *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == loginCookie {
+			login = cookie
+		}
+	}
+	require.NotNil(t, login)
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/containers", nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: login.Value})
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// TestLocalRedirect tests that /login only redirects within this server
+func TestLocalRedirect(t *testing.T) {
+	assert.Equal(t, "/api/containers?x=1", localRedirect("/api/containers?x=1"))
+	for _, target := range []string{"", "https://evil.example.com", "//evil.example.com", "/\\evil.example.com", "javascript:alert(1)"} {
+		assert.Equal(t, "/", localRedirect(target), target)
+	}
+}
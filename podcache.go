@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cacheSyncTimeout bounds how long a request waits for the initial pod list
+// before giving up with 503.
+const cacheSyncTimeout = 10 * time.Second
+
+// podCache serves pod reads for a namespace from a shared informer, so
+// requests don't list pods against the API server every time and watchers
+// can be told about changes as they happen.
+type podCache struct {
+	namespace string
+	informer  cache.SharedIndexInformer
+	lister    corelisters.PodLister
+}
+
+func newPodCache(clientset kubernetes.Interface, namespace string) *podCache {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(namespace))
+	pods := factory.Core().V1().Pods()
+	return &podCache{
+		namespace: namespace,
+		informer:  pods.Informer(),
+		lister:    pods.Lister(),
+	}
+}
+
+// view returns a cache of namespace backed by p's informer, which must watch
+// every namespace. Views aren't started themselves.
+func (p *podCache) view(namespace string) *podCache {
+	return &podCache{namespace: namespace, informer: p.informer, lister: p.lister}
+}
+
+// start runs the informer in the background until stopCh is closed.
+func (p *podCache) start(stopCh <-chan struct{}) {
+	go p.informer.Run(stopCh)
+}
+
+// waitForSync blocks until the initial pod list has been loaded, giving up
+// after cacheSyncTimeout or when ctx is cancelled.
+func (p *podCache) waitForSync(ctx context.Context) error {
+	if p.informer.HasSynced() {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, cacheSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), p.informer.HasSynced) {
+		return fmt.Errorf("pod cache for namespace %q has not synced yet", p.namespace)
+	}
+	return nil
+}
+
+// list returns the cached pods matching selector, sorted by name like the
+// API server would return them.
+func (p *podCache) list(selector labels.Selector) ([]*corev1.Pod, error) {
+	pods, err := p.lister.Pods(p.namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
+
+// get returns a single cached pod by name.
+func (p *podCache) get(name string) (*corev1.Pod, error) {
+	return p.lister.Pods(p.namespace).Get(name)
+}
+
+// subscribe registers handler for pod add/update/delete events in the
+// cache's namespace. Pods already in the cache are delivered as adds first.
+// The returned func removes the handler again.
+func (p *podCache) subscribe(handler cache.ResourceEventHandler) (func(), error) {
+	registration, err := p.informer.AddEventHandler(cache.FilteringResourceEventHandler{
+		// The informer of a view sees every namespace
+		FilterFunc: func(obj interface{}) bool {
+			pod, ok := podFromDeleteEvent(obj)
+			return ok && pod.Namespace == p.namespace
+		},
+		Handler: handler,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() { p.informer.RemoveEventHandler(registration) }, nil
+}
+
+// podFromDeleteEvent unwraps the object passed to OnDelete, which may be a
+// tombstone if the watch missed the final state of the pod.
+func podFromDeleteEvent(obj interface{}) (*corev1.Pod, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	return pod, ok
+}
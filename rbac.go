@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// kubeUserKey is the gin context key holding the authentication/v1
+// UserInfo of a caller who presented a Kubernetes bearer token.
+const kubeUserKey = "kubeUser"
+
+// Review results are cached so a UI refresh or a container list doesn't
+// cost one API call per pod, while revoked access still takes effect
+// within a minute.
+const (
+	reviewCacheTTL  = time.Minute
+	reviewCacheSize = 10000
+)
+
+// kubeAuthorizer authenticates callers by their Kubernetes bearer token
+// with a TokenReview and checks what they may read with
+// SubjectAccessReviews, so cluster RBAC decides who sees which logs.
+type kubeAuthorizer struct {
+	clientset kubernetes.Interface
+	ttl       time.Duration
+
+	mu        sync.Mutex
+	tokens    map[[sha256.Size]byte]cachedUser
+	decisions map[string]cachedDecision
+}
+
+type cachedUser struct {
+	user    *authenticationv1.UserInfo
+	expires time.Time
+}
+
+type cachedDecision struct {
+	allowed bool
+	expires time.Time
+}
+
+func newKubeAuthorizer(clientset kubernetes.Interface) *kubeAuthorizer {
+	return &kubeAuthorizer{
+		clientset: clientset,
+		ttl:       reviewCacheTTL,
+		tokens:    map[[sha256.Size]byte]cachedUser{},
+		decisions: map[string]cachedDecision{},
+	}
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticate returns who token belongs to. Only a hash of the token is
+// kept in the cache.
+func (k *kubeAuthorizer) authenticate(ctx context.Context, token string) (*authenticationv1.UserInfo, error) {
+	hash := sha256.Sum256([]byte(token))
+	k.mu.Lock()
+	cached, ok := k.tokens[hash]
+	k.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.user, nil
+	}
+
+	review, err := k.clientset.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("token review failed: %v", err)
+	}
+	if !review.Status.Authenticated {
+		if review.Status.Error != "" {
+			return nil, fmt.Errorf("invalid token: %s", review.Status.Error)
+		}
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	user := review.Status.User
+	k.mu.Lock()
+	if len(k.tokens) >= reviewCacheSize {
+		k.tokens = map[[sha256.Size]byte]cachedUser{}
+	}
+	k.tokens[hash] = cachedUser{user: &user, expires: time.Now().Add(k.ttl)}
+	k.mu.Unlock()
+	return &user, nil
+}
+
+// canReadLogs reports whether user may get pods/log for pod in namespace,
+// or for every pod in it when pod is empty.
+func (k *kubeAuthorizer) canReadLogs(ctx context.Context, user *authenticationv1.UserInfo, namespace, pod string) (bool, error) {
+	return k.can(ctx, user, authorizationv1.ResourceAttributes{
+		Namespace:   namespace,
+		Verb:        "get",
+		Resource:    "pods",
+		Subresource: "log",
+		Name:        pod,
+	})
+}
+
+// allowed reports whether the caller of c may verb resource in namespace.
+// Callers who authenticated without a Kubernetes token, or a nil
+// authorizer, may.
+func (k *kubeAuthorizer) allowed(c *gin.Context, namespace, verb, resource string) (bool, error) {
+	value, ok := c.Get(kubeUserKey)
+	if k == nil || !ok {
+		return true, nil
+	}
+	return k.can(c.Request.Context(), value.(*authenticationv1.UserInfo), authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      verb,
+		Resource:  resource,
+	})
+}
+
+// can reports whether user may act on the resource described by attrs.
+func (k *kubeAuthorizer) can(ctx context.Context, user *authenticationv1.UserInfo, attrs authorizationv1.ResourceAttributes) (bool, error) {
+	key := strings.Join([]string{user.UID, user.Username, attrs.Namespace, attrs.Verb, attrs.Resource, attrs.Subresource, attrs.Name}, "/")
+	k.mu.Lock()
+	cached, ok := k.decisions[key]
+	k.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.allowed, nil
+	}
+
+	extra := map[string]authorizationv1.ExtraValue{}
+	for name, values := range user.Extra {
+		extra[name] = authorizationv1.ExtraValue(values)
+	}
+	review, err := k.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:               user.Username,
+			UID:                user.UID,
+			Groups:             user.Groups,
+			Extra:              extra,
+			ResourceAttributes: &attrs,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("access review failed: %v", err)
+	}
+
+	allowed := review.Status.Allowed
+	k.mu.Lock()
+	if len(k.decisions) >= reviewCacheSize {
+		k.decisions = map[string]cachedDecision{}
+	}
+	k.decisions[key] = cachedDecision{allowed: allowed, expires: time.Now().Add(k.ttl)}
+	k.mu.Unlock()
+	return allowed, nil
+}
+
+// podFilter returns a func reporting whether the caller of c may read a
+// pod's logs in namespace. Callers who authenticated without a Kubernetes
+// token, or a nil authorizer, may read every pod.
+func (k *kubeAuthorizer) podFilter(c *gin.Context, namespace string) func(pod string) bool {
+	value, ok := c.Get(kubeUserKey)
+	if k == nil || !ok {
+		return func(string) bool { return true }
+	}
+	user := value.(*authenticationv1.UserInfo)
+	ctx := context.WithoutCancel(c.Request.Context())
+
+	// One review settles the common case of access to the whole namespace
+	if all, err := k.canReadLogs(ctx, user, namespace, ""); err == nil && all {
+		return func(string) bool { return true }
+	}
+	return func(pod string) bool {
+		allowed, err := k.canReadLogs(ctx, user, namespace, pod)
+		if err != nil {
+			fmt.Println("Access review failed:", err)
+		}
+		return allowed
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newRBACTestRouter serves web-1 and db-1 with Kubernetes token auth. The
+// fake API server knows the tokens "alice-token" and "bob-token". It lets
+// alice get the logs of web-1 only, and bob the logs of every pod but
+// nothing else. It returns the number of access reviews made.
+func newRBACTestRouter(t *testing.T) (http.Handler, *int32) {
+	clientset := fake.NewSimpleClientset(testPod("web-1", "app"), testPod("db-1", "app"))
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		switch review.Spec.Token {
+		case "alice-token":
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{Username: "alice", UID: "1", Groups: []string{"developers"}}
+		case "bob-token":
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{Username: "bob", UID: "2"}
+		}
+		return true, review, nil
+	})
+	reviews := new(int32)
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		atomic.AddInt32(reviews, 1)
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attrs := review.Spec.ResourceAttributes
+		readsLogs := attrs.Verb == "get" && attrs.Resource == "pods" && attrs.Subresource == "log"
+		review.Status.Allowed = readsLogs && ((review.Spec.User == "alice" && attrs.Name == "web-1") || review.Spec.User == "bob")
+		return true, review, nil
+	})
+
+	return newTestRouterWith(t, func(opts *routerOptions) {
+		opts.clientset = clientset
+		opts.kubeAuth = newKubeAuthorizer(clientset)
+	}), reviews
+}
+
+func bearerRequest(path, token string) *http.Request {
+	req, _ := http.NewRequest("GET", path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// TestKubernetesRBACAuthentication tests that a valid Kubernetes token is required
+func TestKubernetesRBACAuthentication(t *testing.T) {
+	router, _ := newRBACTestRouter(t)
+
+	for _, token := range []string{"", "stolen-token"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, bearerRequest("/api/logs/web-1/app", token))
+		assert.Equal(t, http.StatusUnauthorized, w.Code, token)
+		assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+// TestKubernetesRBACAuthorization tests that callers only see the logs RBAC lets them get
+func TestKubernetesRBACAuthorization(t *testing.T) {
+	router, reviews := newRBACTestRouter(t)
+
+	cases := []struct {
+		path string
+		want int
+	}{
+		{"/api/logs/web-1/app", http.StatusOK},
+		{"/api/logs/db-1/app", http.StatusForbidden},
+		{"/api/logs/web-1/app/download", http.StatusOK},
+		{"/api/logs/all", http.StatusForbidden},
+		{"/api/bundle", http.StatusForbidden},
+		{"/logs", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, bearerRequest(tc.path, "alice-token"))
+		assert.Equal(t, tc.want, w.Code, tc.path)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, bearerRequest("/api/logs/db-1/app", "alice-token"))
+	assert.Contains(t, w.Body.String(), "alice may not get pods/log db-1 in namespace default")
+
+	// Decisions are cached
+	before := atomic.LoadInt32(reviews)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, bearerRequest("/api/logs/web-1/app", "alice-token"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, before, atomic.LoadInt32(reviews))
+}
+
+// TestKubernetesRBACFiltersContainers tests that the container list only shows readable pods
+func TestKubernetesRBACFiltersContainers(t *testing.T) {
+	router, _ := newRBACTestRouter(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, bearerRequest("/api/containers", "alice-token"))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body struct {
+		Containers []PodContainer `json:"containers"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Containers, 1)
+	assert.Equal(t, "web-1", body.Containers[0].PodName)
+}
+
+// TestKubernetesRBACWebSocket tests that WebSocket streams are checked the same way
+func TestKubernetesRBACWebSocket(t *testing.T) {
+	router, _ := newRBACTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	header := http.Header{"Authorization": {"Bearer alice-token"}}
+	base := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	conn, _, err := websocket.DefaultDialer.Dial(base+"/ws/logs/web-1/app", header)
+	require.NoError(t, err)
+	conn.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial(base+"/ws/logs/db-1/app", header)
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+// TestKubernetesRBACBundle tests that a bundle leaves out manifests and events the caller may not read
+func TestKubernetesRBACBundle(t *testing.T) {
+	router, _ := newRBACTestRouter(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, bearerRequest("/api/bundle", "bob-token"))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.Contains(t, names, "web-1/pod.yaml.error")
+	assert.Contains(t, names, "web-1/events.yaml.error")
+	assert.Contains(t, names, "web-1/app.log")
+	assert.NotContains(t, names, "web-1/pod.yaml")
+	assert.NotContains(t, names, "web-1/events.yaml")
+
+	f, err := zr.Open("web-1/pod.yaml.error")
+	require.NoError(t, err)
+	reason, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "left out: the caller may not get pods in namespace default\n", string(reason))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// shutdownRetryAfter is the reconnect delay suggested to WebSocket clients
+// when the server shuts down, long enough for a rollout to bring up the
+// next pod behind the service.
+const shutdownRetryAfter = 2 * time.Second
+
+// shutdownCloseReason is the close frame reason sent on shutdown. The UI
+// reads the retry-after hint from it.
+var shutdownCloseReason = fmt.Sprintf("server restarting; retry-after=%d", int(shutdownRetryAfter/time.Second))
+
+// drainer tracks long-lived WebSocket streams so the server can tell them
+// to go away on shutdown and wait for them to finish. http.Server.Shutdown
+// does not wait for hijacked connections.
+type drainer struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	draining bool
+	wg       sync.WaitGroup
+}
+
+func newDrainer() *drainer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &drainer{ctx: ctx, cancel: cancel}
+}
+
+// track registers a stream and returns the func to call when it ends. It
+// fails once draining has started.
+func (d *drainer) track() (func(), bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return nil, false
+	}
+	d.wg.Add(1)
+	var once sync.Once
+	return func() { once.Do(d.wg.Done) }, true
+}
+
+// drain tells every tracked stream to close and waits up to timeout for
+// them to finish. It reports whether they all did.
+func (d *drainer) drain(timeout time.Duration) bool {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+	d.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDrainClosesWebSockets tests that shutdown sends open WebSockets a restart close frame and waits for them
+func TestDrainClosesWebSockets(t *testing.T) {
+	drainer := newDrainer()
+	server := httptest.NewServer(newTestRouterWith(t, func(opts *routerOptions) { opts.drainer = drainer }, testPod("web-1", "app")))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/containers/watch"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var msg map[string]interface{}
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "added", msg["type"])
+
+	drained := make(chan bool, 1)
+	go func() { drained <- drainer.drain(5 * time.Second) }()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.ErrorAs(t, err, &closeErr)
+	assert.Equal(t, websocket.CloseServiceRestart, closeErr.Code)
+	assert.Contains(t, closeErr.Text, "retry-after=2")
+	assert.True(t, <-drained, "the stream finished before the grace period")
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+}
+
+// TestDrainTimesOut tests that drain gives up on streams that outlive the grace period
+func TestDrainTimesOut(t *testing.T) {
+	drainer := newDrainer()
+	done, ok := drainer.track()
+	require.True(t, ok)
+	defer done()
+
+	assert.False(t, drainer.drain(10*time.Millisecond))
+	_, ok = drainer.track()
+	assert.False(t, ok, "no new streams while draining")
+}
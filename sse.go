@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes"
+)
+
+// sseKeepaliveInterval is how often a quiet Server-Sent Events stream gets a
+// comment line, so proxies don't time it out as idle.
+const sseKeepaliveInterval = 30 * time.Second
+
+// sseWriter writes Server-Sent Events, serializing the log lines and the
+// keepalive comments.
+type sseWriter struct {
+	mu sync.Mutex
+	w  gin.ResponseWriter
+}
+
+// event writes one event and flushes it. An empty id is left out.
+func (s *sseWriter) event(id string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id != "" {
+		fmt.Fprintf(s.w, "id: %s\n", id)
+	}
+	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", payload); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
+
+// comment writes a comment line, which clients ignore.
+func (s *sseWriter) comment(text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return nil
+}
+
+// logEventStreamHandler serves /api/logs/:pod/:container/stream, the
+// WebSocket follow stream as Server-Sent Events for networks that don't
+// pass WebSockets. Messages are the same as on /ws/logs, each an event
+// whose ID is the line's resume point, "<timestamp>,<hash>", so a client
+// that reconnects with Last-Event-ID continues after the last line it
+// got. On shutdown the stream ends and clients reconnect after the retry
+// delay.
+func logEventStreamHandler(clientset kubernetes.Interface, d *drainer, limits tailLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		namespace := c.GetString("namespace")
+		podName := c.Param("pod")
+		containerName := c.Param("container")
+
+		podLogOpts, err := logOptionsFromQuery(c, containerName, limits)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter, err := lineFilterFromQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var resume *resumePoint
+		if lastID := c.GetHeader("Last-Event-ID"); lastID != "" {
+			resume, err = parseResumePoint(lastID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			resume.apply(podLogOpts, limits)
+		}
+		podLogOpts.Follow = true
+		keepTimestamps := podLogOpts.Timestamps
+		podLogOpts.Timestamps = true
+
+		done, ok := d.track()
+		if !ok {
+			c.Header("Retry-After", fmt.Sprint(int(shutdownRetryAfter/time.Second)))
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
+			return
+		}
+		defer done()
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-d.ctx.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		req := clientset.CoreV1().Pods(namespace).GetLogs(podName, podLogOpts)
+		logStream, err := openLogStream(ctx, req)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer logStream.Close()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		// Stop nginx from buffering the stream
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		events := &sseWriter{w: c.Writer}
+		fmt.Fprintf(c.Writer, "retry: %d\n\n", shutdownRetryAfter.Milliseconds())
+		c.Writer.Flush()
+
+		keepaliveDone := make(chan struct{})
+		go func() {
+			defer close(keepaliveDone)
+			ticker := time.NewTicker(sseKeepaliveInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := events.comment("keepalive"); err != nil {
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+
+		err = followLogs(logStream, filter, keepTimestamps, resume, func(timestamp string, msg gin.H) error {
+			id := ""
+			if timestamp != "" {
+				id = formatResumePoint(timestamp, msg["hash"].(string))
+			}
+			return events.event(id, msg)
+		})
+		if err != nil && ctx.Err() == nil {
+			events.event("", gin.H{"error": err.Error()})
+		}
+		// The writer can't be used once the handler returns
+		cancel()
+		<-keepaliveDone
+	}
+}
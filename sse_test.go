@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// TestLogEventStream tests that /stream serves the follow stream as Server-Sent Events
+func TestLogEventStream(t *testing.T) {
+	router := newTestRouter(t, "secret", testPod("web-1", "app"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/logs/web-1/app/stream?key=secret", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(w.Body.String(), "retry: 2000\n\n"), w.Body.String())
+	assert.Contains(t, w.Body.String(), `"log":"fake logs"`)
+
+	cases := map[string]int{
+		"/api/logs/web-1/app/stream":                    http.StatusForbidden,
+		"/api/namespaces/default/logs/web-1/app/stream": http.StatusForbidden,
+	}
+	for path, want := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, path)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/logs/web-1/app/stream?key=secret", nil)
+	req.Header.Set("Last-Event-ID", "yesterday")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestFollowLogsResume tests that lines up to the resume point are skipped once
+func TestFollowLogsResume(t *testing.T) {
+	stream := strings.NewReader(strings.Join([]string{
+		"2026-10-17T09:00:00.1Z before",
+		"2026-10-17T09:00:00.5Z last seen",
+		"2026-10-17T09:00:00.7Z new",
+		"2026-10-17T09:00:00.2Z late but new",
+		"no timestamp",
+	}, "\n"))
+	resume, err := parseResumePoint("2026-10-17T09:00:00.5Z")
+	require.NoError(t, err)
+
+	var ids, lines []string
+	err = followLogs(stream, nil, false, resume, func(timestamp string, msg gin.H) error {
+		ids = append(ids, timestamp)
+		lines = append(lines, msg["log"].(string))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new", "late but new", "no timestamp"}, lines)
+	assert.Equal(t, "2026-10-17T09:00:00.7Z", ids[0])
+}
+
+// TestResumePointApply tests that a resume reads from the second of the last line, within the tail cap
+func TestResumePointApply(t *testing.T) {
+	resume, err := parseResumePoint("2026-10-17T09:00:05.123456789Z")
+	require.NoError(t, err)
+
+	lines := int64(100)
+	opts := &corev1.PodLogOptions{TailLines: &lines}
+	resume.apply(opts, tailLimits{defaultLines: 100})
+	assert.Nil(t, opts.TailLines)
+	assert.Equal(t, time.Date(2026, 10, 17, 9, 0, 5, 0, time.UTC), opts.SinceTime.Time.UTC())
+
+	resume.apply(opts, tailLimits{defaultLines: 100, maxLines: 5000})
+	require.NotNil(t, opts.TailLines)
+	assert.Equal(t, int64(5000), *opts.TailLines)
+}
+
+// TestFollowLogsResumeHash tests that lines of the same instant are told apart by the hash of the last one seen
+func TestFollowLogsResumeHash(t *testing.T) {
+	stream := strings.NewReader(strings.Join([]string{
+		"2026-10-17T09:00:00.5Z first",
+		"2026-10-17T09:00:00.5Z last seen",
+		"2026-10-17T09:00:00.5Z same instant, new",
+		"2026-10-17T09:00:01Z later",
+	}, "\n"))
+	// As sent back in Last-Event-ID
+	resume, err := parseResumePoint(formatResumePoint("2026-10-17T09:00:00.5Z", lineHash("last seen")))
+	require.NoError(t, err)
+
+	var lines []string
+	err = followLogs(stream, nil, false, resume, func(_ string, msg gin.H) error {
+		lines = append(lines, msg["log"].(string))
+		assert.Equal(t, lineHash(msg["log"].(string)), msg["hash"])
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"same instant, new", "later"}, lines)
+}
+
+// TestWSLogsResumeFrom tests that the WebSocket rejects a malformed resume point before upgrading
+func TestWSLogsResumeFrom(t *testing.T) {
+	router := newTestRouter(t, "secret", testPod("web-1", "app"))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/ws/logs/web-1/app?key=secret&resumeFrom=yesterday,abc", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid resume point")
+}
+
+// TestFollowLogsResumeGap tests that a gap message marks lines cut off between the resume point and the first new line
+func TestFollowLogsResumeGap(t *testing.T) {
+	follow := func(resumeFrom string, lines ...string) []gin.H {
+		t.Helper()
+		resume, err := parseResumePoint(resumeFrom)
+		require.NoError(t, err)
+		var msgs []gin.H
+		err = followLogs(strings.NewReader(strings.Join(lines, "\n")), nil, false, resume, func(_ string, msg gin.H) error {
+			msgs = append(msgs, msg)
+			return nil
+		})
+		require.NoError(t, err)
+		return msgs
+	}
+
+	// The tail cap left out the last line seen and what followed it
+	msgs := follow(formatResumePoint("2026-10-17T09:00:00.5Z", lineHash("last seen")),
+		"2026-10-17T09:00:03Z new", "2026-10-17T09:00:04Z newer")
+	require.Len(t, msgs, 3)
+	assert.Equal(t, true, msgs[0]["gap"])
+	assert.Equal(t, "new", msgs[1]["log"])
+	assert.Nil(t, msgs[2]["gap"])
+
+	// Everything since the resume point is there
+	msgs = follow(formatResumePoint("2026-10-17T09:00:00.5Z", lineHash("last seen")),
+		"2026-10-17T09:00:00.5Z last seen", "2026-10-17T09:00:03Z new")
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "new", msgs[0]["log"])
+
+	msgs = follow("2026-10-17T09:00:00.5Z", "2026-10-17T09:00:00.2Z before", "2026-10-17T09:00:03Z new")
+	require.Len(t, msgs, 1)
+	assert.Nil(t, msgs[0]["gap"])
+}
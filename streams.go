@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/client-go/rest"
+)
+
+// upstreamStreams counts the log streams open to the Kubernetes API. It is
+// exported as the upstream_log_streams metric; a value that keeps growing
+// while clients come and go means streams are leaking.
+var upstreamStreams atomic.Int64
+
+// openLogStream opens a log request, counting it in upstreamStreams until it
+// is closed, and what it reads in the relayed bytes and lines metrics. The
+// stream ends when ctx does, so pass the request's or WebSocket session's
+// context rather than a background one.
+func openLogStream(ctx context.Context, req *rest.Request) (io.ReadCloser, error) {
+	stream, err := req.Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	upstreamStreams.Add(1)
+	return &countedStream{ReadCloser: stream, relayed: newRelayCounter(logStreamLabels(req.URL()))}, nil
+}
+
+// countedStream counts what is read and decrements upstreamStreams once
+// when closed.
+type countedStream struct {
+	io.ReadCloser
+	relayed *relayCounter
+	once    sync.Once
+}
+
+func (s *countedStream) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	s.relayed.add(p[:n])
+	return n, err
+}
+
+func (s *countedStream) Close() error {
+	s.once.Do(func() { upstreamStreams.Add(-1) })
+	return s.ReadCloser.Close()
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Keys recognised as the level, message and time of a structured line, in
+// order of preference.
+var (
+	levelKeys = []string{"level", "lvl", "severity", "log.level"}
+	msgKeys   = []string{"msg", "message"}
+	timeKeys  = []string{"time", "ts", "timestamp", "@timestamp"}
+)
+
+// levelRanks orders normalized levels so filters like level>=warn work.
+var levelRanks = map[string]int{
+	"trace": 0,
+	"debug": 1,
+	"info":  2,
+	"warn":  3,
+	"error": 4,
+	"fatal": 5,
+}
+
+// structuredLine is a log line parsed as JSON or logfmt, with the common
+// level, message and time keys normalized.
+type structuredLine struct {
+	Format string
+	Fields map[string]interface{}
+	Level  string
+	Msg    string
+	Time   string
+}
+
+// parseStructured parses line as a JSON object or as logfmt. It returns
+// nil for lines in neither format.
+func parseStructured(line string) *structuredLine {
+	trimmed := strings.TrimSpace(line)
+	var parsed *structuredLine
+	if strings.HasPrefix(trimmed, "{") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(trimmed), &fields); err == nil {
+			parsed = &structuredLine{Format: "json", Fields: fields}
+		}
+	} else if fields, ok := parseLogfmt(trimmed); ok {
+		parsed = &structuredLine{Format: "logfmt", Fields: fields}
+	}
+	if parsed == nil {
+		return nil
+	}
+
+	if v, ok := firstField(parsed.Fields, levelKeys); ok {
+		parsed.Level = normalizeLevel(v)
+	}
+	if v, ok := firstField(parsed.Fields, msgKeys); ok {
+		parsed.Msg = fieldString(v)
+	}
+	if v, ok := firstField(parsed.Fields, timeKeys); ok {
+		parsed.Time = fieldString(v)
+	}
+	return parsed
+}
+
+// parseLogfmt parses key=value pairs separated by spaces, with optional
+// double-quoted values. Every token must be a pair so plain text containing
+// an '=' somewhere isn't mistaken for logfmt.
+func parseLogfmt(line string) (map[string]interface{}, bool) {
+	fields := map[string]interface{}{}
+	i := 0
+	for i < len(line) {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i == len(line) {
+			break
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '"' {
+			i++
+		}
+		if i == start || i == len(line) || line[i] != '=' {
+			return nil, false
+		}
+		key := line[start:i]
+		i++
+
+		var value string
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, false
+			}
+			unquoted, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				return nil, false
+			}
+			value = unquoted
+			i = end + 1
+		} else {
+			start = i
+			for i < len(line) && line[i] != ' ' {
+				i++
+			}
+			value = line[start:i]
+		}
+		fields[key] = value
+	}
+	return fields, len(fields) > 0
+}
+
+// firstField returns the value of the first of keys present in fields.
+func firstField(fields map[string]interface{}, keys []string) (interface{}, bool) {
+	for _, key := range keys {
+		if v, ok := lookupField(fields, key); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// lookupField finds key in fields, either as a literal key or as a dotted
+// path into nested JSON objects.
+func lookupField(fields map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := fields[key]; ok {
+		return v, true
+	}
+	parts := strings.Split(key, ".")
+	var current interface{} = fields
+	for _, part := range parts {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// fieldString renders a field value for display and comparison.
+func fieldString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(b)
+	}
+}
+
+// normalizeLevel maps common spellings and pino/bunyan numeric levels onto
+// trace, debug, info, warn, error and fatal.
+func normalizeLevel(v interface{}) string {
+	if n, ok := v.(float64); ok {
+		switch {
+		case n >= 60:
+			return "fatal"
+		case n >= 50:
+			return "error"
+		case n >= 40:
+			return "warn"
+		case n >= 30:
+			return "info"
+		case n >= 20:
+			return "debug"
+		default:
+			return "trace"
+		}
+	}
+
+	level := strings.ToLower(fieldString(v))
+	switch level {
+	case "warning":
+		return "warn"
+	case "err", "eror":
+		return "error"
+	case "crit", "critical", "panic", "dpanic", "emerg", "alert":
+		return "fatal"
+	case "dbug":
+		return "debug"
+	case "information", "notice":
+		return "info"
+	}
+	return level
+}
+
+// fieldFilter is a condition on one field of a structured line, e.g.
+// level>=warn or user_id=42.
+type fieldFilter struct {
+	key   string
+	op    string
+	value string
+}
+
+// fieldFilterOps are tried longest first so ">=" isn't read as ">".
+var fieldFilterOps = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+// parseFieldFilter parses an expression of the form key<op>value.
+func parseFieldFilter(expr string) (fieldFilter, error) {
+	best := -1
+	var bestOp string
+	for _, op := range fieldFilterOps {
+		if i := strings.Index(expr, op); i > 0 && (best == -1 || i < best || (i == best && len(op) > len(bestOp))) {
+			best, bestOp = i, op
+		}
+	}
+	if best == -1 {
+		return fieldFilter{}, fmt.Errorf("invalid field parameter %q: expected key=value, key!=value, key>=value, key<=value, key>value or key<value", expr)
+	}
+	return fieldFilter{
+		key:   strings.TrimSpace(expr[:best]),
+		op:    bestOp,
+		value: strings.TrimSpace(expr[best+len(bestOp):]),
+	}, nil
+}
+
+// matches reports whether the structured line satisfies the filter. Lines
+// that aren't structured or lack the key never match. Levels compare by
+// severity, numbers numerically and anything else as strings.
+func (f fieldFilter) matches(line *structuredLine) bool {
+	if line == nil {
+		return false
+	}
+
+	var actual string
+	var cmp int
+	if isLevelKey(f.key) && line.Level != "" {
+		actual = line.Level
+		want := normalizeLevel(f.value)
+		actualRank, ok1 := levelRanks[actual]
+		wantRank, ok2 := levelRanks[want]
+		if !ok1 || !ok2 {
+			cmp = strings.Compare(actual, want)
+		} else {
+			cmp = actualRank - wantRank
+		}
+	} else {
+		v, ok := lookupField(line.Fields, f.key)
+		if !ok {
+			return false
+		}
+		actual = fieldString(v)
+		a, errA := strconv.ParseFloat(actual, 64)
+		b, errB := strconv.ParseFloat(f.value, 64)
+		switch {
+		case errA == nil && errB == nil && a < b:
+			cmp = -1
+		case errA == nil && errB == nil && a > b:
+			cmp = 1
+		case errA == nil && errB == nil:
+			cmp = 0
+		default:
+			cmp = strings.Compare(actual, f.value)
+		}
+	}
+
+	switch f.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	}
+	return false
+}
+
+func isLevelKey(key string) bool {
+	for _, k := range levelKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// addStructuredFields adds the parsed fields of line to a streamed log
+// message, if it is JSON or logfmt: format, fields and the normalized
+// level, msg and time.
+func addStructuredFields(msg gin.H, line string) {
+	parsed := parseStructured(line)
+	if parsed == nil {
+		return
+	}
+	msg["format"] = parsed.Format
+	msg["fields"] = parsed.Fields
+	if parsed.Level != "" {
+		msg["level"] = parsed.Level
+	}
+	if parsed.Msg != "" {
+		msg["msg"] = parsed.Msg
+	}
+	if parsed.Time != "" {
+		msg["time"] = parsed.Time
+	}
+}
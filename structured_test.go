@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseStructuredJSON tests JSON detection and normalization of level, msg and time
+func TestParseStructuredJSON(t *testing.T) {
+	parsed := parseStructured(`{"severity":"WARNING","message":"disk low","@timestamp":"2025-01-02T03:04:05Z","user_id":42}`)
+	require.NotNil(t, parsed)
+
+	assert.Equal(t, "json", parsed.Format)
+	assert.Equal(t, "warn", parsed.Level)
+	assert.Equal(t, "disk low", parsed.Msg)
+	assert.Equal(t, "2025-01-02T03:04:05Z", parsed.Time)
+	assert.Equal(t, float64(42), parsed.Fields["user_id"])
+}
+
+// TestParseStructuredNumericLevel tests pino style numeric levels
+func TestParseStructuredNumericLevel(t *testing.T) {
+	parsed := parseStructured(`{"level":50,"msg":"boom"}`)
+	require.NotNil(t, parsed)
+	assert.Equal(t, "error", parsed.Level)
+}
+
+// TestParseStructuredLogfmt tests logfmt detection including quoted values
+func TestParseStructuredLogfmt(t *testing.T) {
+	parsed := parseStructured(`ts=2025-01-02T03:04:05Z lvl=info msg="request done" path=/api status=200`)
+	require.NotNil(t, parsed)
+
+	assert.Equal(t, "logfmt", parsed.Format)
+	assert.Equal(t, "info", parsed.Level)
+	assert.Equal(t, "request done", parsed.Msg)
+	assert.Equal(t, "/api", parsed.Fields["path"])
+}
+
+// TestParseStructuredPlainText tests that plain text lines aren't parsed
+func TestParseStructuredPlainText(t *testing.T) {
+	assert.Nil(t, parseStructured("Starting server on port=8080"))
+	assert.Nil(t, parseStructured("GET /healthcheck 200"))
+	assert.Nil(t, parseStructured("{not json"))
+}
+
+// TestFieldFilters tests level ordering, numeric and string comparisons and nested keys
+func TestFieldFilters(t *testing.T) {
+	line := parseStructured(`{"level":"error","user_id":42,"http":{"status":"503"},"env":"prod"}`)
+	require.NotNil(t, line)
+
+	cases := map[string]bool{
+		"level>=warn":      true,
+		"level<warn":       false,
+		"level=error":      true,
+		"user_id=42":       true,
+		"user_id>100":      false,
+		"user_id!=7":       true,
+		"http.status>=500": true,
+		"env=prod":         true,
+		"env!=prod":        false,
+		"missing=x":        false,
+	}
+	for expr, want := range cases {
+		filter, err := parseFieldFilter(expr)
+		require.NoError(t, err, expr)
+		assert.Equal(t, want, filter.matches(line), expr)
+	}
+
+	_, err := parseFieldFilter("level")
+	assert.Error(t, err)
+}
+
+// TestFieldFilterSkipsPlainLines tests that field filters drop unstructured lines
+func TestFieldFilterSkipsPlainLines(t *testing.T) {
+	f, err := lineFilterFromQuery(testContext("/?field=level%3E%3Dwarn"))
+	require.NoError(t, err)
+
+	assert.True(t, f.matches(`level=warn msg=slow`))
+	assert.False(t, f.matches(`level=info msg=ok`))
+	assert.False(t, f.matches(`plain WARN text`))
+}
+
+// TestAddStructuredFields tests that parsed fields are attached to streamed messages
+func TestAddStructuredFields(t *testing.T) {
+	msg := gin.H{"log": `{"lvl":"debug","msg":"hi"}`}
+	addStructuredFields(msg, msg["log"].(string))
+
+	assert.Equal(t, "json", msg["format"])
+	assert.Equal(t, "debug", msg["level"])
+	assert.Equal(t, "hi", msg["msg"])
+	assert.NotNil(t, msg["fields"])
+
+	plain := gin.H{"log": "hello"}
+	addStructuredFields(plain, "hello")
+	assert.NotContains(t, plain, "fields")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloadInterval is how often the certificate, key and client CA files
+// are checked for changes. Secrets mounted into a pod are updated in place,
+// so rotating them needs no restart.
+const certReloadInterval = 30 * time.Second
+
+// Values of tls.clientAuth.
+const (
+	clientAuthRequire  = "require"
+	clientAuthOptional = "optional"
+)
+
+// certReloader serves the current TLS certificate and client CA bundle,
+// reloading them when their files change. A reload that fails keeps the
+// previous, working files in use.
+type certReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// newCertReloader loads the files named in cfg, failing if any is unusable.
+func newCertReloader(cfg tlsConfig) (*certReloader, error) {
+	r := &certReloader{
+		certFile:     cfg.CertFile,
+		keyFile:      cfg.KeyFile,
+		clientCAFile: cfg.ClientCAFile,
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.clientCAFile != "" {
+		files = append(files, r.clientCAFile)
+	}
+	return files
+}
+
+// reload reads the files again if any has changed since the last load and
+// reports whether it did.
+func (r *certReloader) reload() (bool, error) {
+	modTimes := map[string]time.Time{}
+	changed := false
+	r.mu.RLock()
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			r.mu.RUnlock()
+			return false, err
+		}
+		modTimes[file] = info.ModTime()
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			changed = true
+		}
+	}
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading TLS certificate: %v", err)
+	}
+	var clientCAs *x509.CertPool
+	if r.clientCAFile != "" {
+		pem, err := os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("reading client CA bundle: %v", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("client CA bundle %s holds no PEM certificates", r.clientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return true, nil
+}
+
+// watch reloads the files every interval until stopCh is closed.
+func (r *certReloader) watch(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				fmt.Println("TLS reload failed, keeping the current certificate:", err)
+			} else if reloaded {
+				fmt.Println("TLS certificate reloaded")
+			}
+		}
+	}
+}
+
+// tlsConfig returns a server TLS config that picks up reloaded files on
+// every handshake. With a client CA bundle, clients must present a
+// certificate signed by it, or may present one when clientAuth is
+// "optional".
+func (r *certReloader) tlsConfig(clientAuth string) *tls.Config {
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	base.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.cert, nil
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.GetCertificate = nil
+		cfg.Certificates = []tls.Certificate{*r.cert}
+		if r.clientCAs != nil {
+			cfg.ClientCAs = r.clientCAs
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			if clientAuth == clientAuthOptional {
+				cfg.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+		}
+		return cfg, nil
+	}
+	return base
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate and key signed by parent, or self-signed when
+// parent is nil.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+	kpem []byte
+}
+
+func newTestCert(t *testing.T, name string, isCA bool, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		kpem: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// writeServerCert writes c as the server certificate and moves the files'
+// modification time forward so the reloader sees the change.
+func writeServerCert(t *testing.T, cfg tlsConfig, c *testCert, modTime time.Time) {
+	require.NoError(t, os.WriteFile(cfg.CertFile, c.pem, 0o600))
+	require.NoError(t, os.WriteFile(cfg.KeyFile, c.kpem, 0o600))
+	require.NoError(t, os.Chtimes(cfg.CertFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(cfg.KeyFile, modTime, modTime))
+}
+
+func startTLSServer(t *testing.T, reloader *certReloader, clientAuth string) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.TLS = reloader.tlsConfig(clientAuth)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func tlsClient(ca *testCert, client *testCert) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	cfg := &tls.Config{RootCAs: roots}
+	if client != nil {
+		cert, _ := tls.X509KeyPair(client.pem, client.kpem)
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, DisableKeepAlives: true}}
+}
+
+// TestCertReloaderReloadsChangedFiles tests that a rotated certificate is served without a restart
+func TestCertReloaderReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := tlsConfig{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key")}
+	ca := newTestCert(t, "ca", true, nil)
+	writeServerCert(t, cfg, newTestCert(t, "first", false, ca), time.Now().Add(-time.Minute))
+
+	reloader, err := newCertReloader(cfg)
+	require.NoError(t, err)
+	server := startTLSServer(t, reloader, clientAuthRequire)
+
+	resp, err := tlsClient(ca, nil).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "first", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	reloaded, err := reloader.reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "unchanged files are not reloaded")
+
+	writeServerCert(t, cfg, newTestCert(t, "second", false, ca), time.Now())
+	reloaded, err = reloader.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	resp, err = tlsClient(ca, nil).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "second", resp.TLS.PeerCertificates[0].Subject.CommonName)
+
+	// A broken rotation keeps the last good certificate
+	require.NoError(t, os.WriteFile(cfg.KeyFile, []byte("not a key"), 0o600))
+	require.NoError(t, os.Chtimes(cfg.KeyFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	_, err = reloader.reload()
+	assert.Error(t, err)
+	resp, err = tlsClient(ca, nil).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "second", resp.TLS.PeerCertificates[0].Subject.CommonName)
+}
+
+// TestCertReloaderClientAuth tests that mutual TLS requires a client certificate signed by the bundle
+func TestCertReloaderClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	cfg := tlsConfig{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	ca := newTestCert(t, "ca", true, nil)
+	otherCA := newTestCert(t, "other-ca", true, nil)
+	writeServerCert(t, cfg, newTestCert(t, "server", false, ca), time.Now())
+	require.NoError(t, os.WriteFile(cfg.ClientCAFile, ca.pem, 0o600))
+
+	reloader, err := newCertReloader(cfg)
+	require.NoError(t, err)
+
+	required := startTLSServer(t, reloader, clientAuthRequire)
+	_, err = tlsClient(ca, nil).Get(required.URL)
+	assert.Error(t, err, "no client certificate")
+	_, err = tlsClient(ca, newTestCert(t, "intruder", false, otherCA)).Get(required.URL)
+	assert.Error(t, err, "client certificate from another CA")
+	resp, err := tlsClient(ca, newTestCert(t, "alice", false, ca)).Get(required.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	optional := startTLSServer(t, reloader, clientAuthOptional)
+	resp, err = tlsClient(ca, nil).Get(optional.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -24,6 +24,21 @@ func getHTMLUI() string {
             background-color: #3b82f6;
             color: white;
         }
+        .log-line summary {
+            cursor: pointer;
+            list-style: none;
+        }
+        .log-line summary::-webkit-details-marker {
+            display: none;
+        }
+        .log-time {
+            color: #6b7280;
+            margin-right: 0.5rem;
+        }
+        .log-fields td {
+            padding: 0 0.75rem 0 0;
+            vertical-align: top;
+        }
         .spinner {
             display: inline-block;
             width: 14px;
@@ -46,7 +61,15 @@ func getHTMLUI() string {
             <div class="p-6 border-b border-gray-200">
                 <h1 class="text-2xl font-bold text-gray-800">k8s-simple-logs</h1>
                 <p class="text-sm text-gray-600 mt-1" id="namespace-info">Loading...</p>
+                <select
+                    id="namespace-select"
+                    class="hidden w-full mt-2 px-2 py-1 border border-gray-300 rounded-md text-sm focus:outline-none focus:ring-2 focus:ring-blue-500"
+                ></select>
                 <p class="text-xs text-gray-500 mt-1" id="version-info">version: <span id="app-version">...</span></p>
+                <p class="hidden text-xs text-gray-500 mt-1" id="session-info">
+                    Signed in as <span id="session-user"></span> &middot;
+                    <a href="/logout" class="text-blue-600 hover:underline">Log out</a>
+                </p>
             </div>
 
             <!-- Search -->
@@ -70,14 +93,9 @@ func getHTMLUI() string {
                 </div>
             </div>
 
-            <!-- Refresh Button -->
+            <!-- Live Update Status -->
             <div class="p-4 border-t border-gray-200">
-                <button
-                    id="refresh-btn"
-                    class="w-full bg-blue-500 hover:bg-blue-600 text-white font-medium py-2 px-4 rounded-md transition"
-                >
-                    Refresh Containers
-                </button>
+                <p class="text-sm text-gray-500" id="watch-status">Connecting to live updates...</p>
             </div>
         </div>
 
@@ -101,6 +119,12 @@ func getHTMLUI() string {
                         >
                             Auto-scroll: ON
                         </button>
+                        <button
+                            id="download-logs-btn"
+                            class="px-4 py-2 bg-blue-500 hover:bg-blue-600 text-white font-medium rounded-md transition"
+                        >
+                            Download
+                        </button>
                         <button
                             id="clear-logs-btn"
                             class="px-4 py-2 bg-gray-500 hover:bg-gray-600 text-white font-medium rounded-md transition"
@@ -127,13 +151,48 @@ func getHTMLUI() string {
         let currentPod = null;
         let currentContainer = null;
         let ws = null;
+        let eventSource = null;
+        // Set once a WebSocket fails to open, e.g. behind a proxy that strips
+        // upgrades; logs are then followed with Server-Sent Events instead
+        let useEventStream = false;
+        // Timestamp and hash of the last line shown, so a reconnect
+        // continues after it rather than repeating the tail
+        let lastLine = null;
         let autoScroll = true;
         let containers = [];
+        let podContainers = {}; // pod name -> containers, kept current by the watch
+        let watchWs = null;
+        let watchReconnectDelay = 2000;
+        let currentNamespace = null; // null until known; routes then use /namespaces/:ns
         let reconnectAttempts = 0;
         let maxReconnectAttempts = 5;
         let reconnectDelay = 2000; // Start with 2 seconds
+        const CLOSE_SERVICE_RESTART = 1012;
+
+        // When the server shuts down it closes WebSockets with code 1012 and
+        // a "retry-after=N" reason; returns the suggested delay in ms, or
+        // null for any other close.
+        function restartDelay(event) {
+            if (event.code !== CLOSE_SERVICE_RESTART) {
+                return null;
+            }
+            const match = /retry-after=(\d+)/.exec(event.reason || '');
+            return match ? parseInt(match[1], 10) * 1000 : reconnectDelay;
+        }
         const API_KEY = new URLSearchParams(window.location.search).get('key') || '';
 
+        // WebSockets pass the key as a subprotocol rather than in the URL,
+        // where it would end up in proxy logs
+        function wsProtocols() {
+            const protocols = ['k8s-simple-logs'];
+            if (API_KEY) {
+                const encoded = btoa(String.fromCharCode(...new TextEncoder().encode(API_KEY)))
+                    .replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+                protocols.push('k8s-simple-logs.key.' + encoded);
+            }
+            return protocols;
+        }
+
         // Fetch and display version
         async function loadVersion() {
             try {
@@ -145,27 +204,164 @@ func getHTMLUI() string {
             }
         }
 
+        // Send the browser to sign in when the session has expired, coming
+        // back to the current page afterwards
+        function redirectToLogin(data) {
+            if (data && data.login) {
+                window.location.href = data.login + '?redirect=' + encodeURIComponent(window.location.pathname + window.location.search);
+                return true;
+            }
+            return false;
+        }
+
+        // Show who is signed in, when signing in is enabled
+        async function loadSession() {
+            try {
+                const url = API_KEY ? '/api/session?key=' + encodeURIComponent(API_KEY) : '/api/session';
+                const response = await fetch(url);
+                const data = await response.json();
+                if (data.user && data.logout) {
+                    document.getElementById('session-user').textContent = data.user;
+                    document.getElementById('session-info').classList.remove('hidden');
+                }
+            } catch (error) {
+                console.error('Failed to load session:', error);
+            }
+        }
+
+        // Path segment selecting the current namespace on namespaced routes
+        function namespacePath() {
+            return currentNamespace === null ? '' : '/namespaces/' + encodeURIComponent(currentNamespace);
+        }
+
+        // Fetch served namespaces and show the switcher if there is a choice
+        async function loadNamespaces() {
+            try {
+                const url = API_KEY ? '/api/namespaces?key=' + encodeURIComponent(API_KEY) : '/api/namespaces';
+                const response = await fetch(url);
+                const data = await response.json();
+                if (data.error || !data.namespaces || data.namespaces.length < 2) {
+                    return;
+                }
+
+                const select = document.getElementById('namespace-select');
+                select.innerHTML = data.namespaces.map(ns => '<option value="' + escapeHtml(ns) + '">' + escapeHtml(ns) + '</option>').join('');
+                select.value = currentNamespace || data.default;
+                select.classList.remove('hidden');
+            } catch (error) {
+                console.error('Failed to load namespaces:', error);
+            }
+        }
+
+        // Switch to another namespace, dropping streams for the old one
+        function switchNamespace(ns) {
+            currentNamespace = ns;
+            currentPod = null;
+            currentContainer = null;
+            closeLogStream();
+            if (watchWs) {
+                watchWs.onclose = null;
+                watchWs.close();
+                watchWs = null;
+            }
+            document.getElementById('selected-container').textContent = 'Select a container from the sidebar';
+            document.getElementById('selected-pod').textContent = 'No container selected';
+            clearLogs();
+            loadContainers();
+        }
+
         // Fetch containers list
         async function loadContainers() {
             try {
-                const url = API_KEY ? '/api/containers?key=' + encodeURIComponent(API_KEY) : '/api/containers';
+                const path = '/api' + namespacePath() + '/containers';
+                const url = API_KEY ? path + '?key=' + encodeURIComponent(API_KEY) : path;
                 const response = await fetch(url);
                 const data = await response.json();
 
                 if (data.error) {
+                    if (redirectToLogin(data)) {
+                        return;
+                    }
                     showError('Authentication required. Add ?key=YOUR_KEY to the URL.');
                     return;
                 }
 
-                containers = data.containers;
+                podContainers = {};
+                (data.containers || []).forEach(c => {
+                    (podContainers[c.podName] = podContainers[c.podName] || []).push(c);
+                });
+                currentNamespace = data.namespace;
                 document.getElementById('namespace-info').textContent = 'Namespace: ' + data.namespace;
-                renderContainers(containers);
+                updateContainers();
+                connectContainerWatch();
             } catch (error) {
                 console.error('Failed to load containers:', error);
                 showError('Failed to load containers: ' + error.message);
             }
         }
 
+        // Rebuild the flat container list from podContainers and re-render
+        function updateContainers() {
+            containers = Object.keys(podContainers).sort().flatMap(pod => podContainers[pod]);
+            renderFilteredContainers();
+        }
+
+        // Follow pod add/update/delete events so the sidebar stays current
+        function connectContainerWatch() {
+            if (watchWs) {
+                return;
+            }
+            const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+            const wsUrl = protocol + '//' + window.location.host + '/api' + namespacePath() + '/containers/watch';
+            const status = document.getElementById('watch-status');
+
+            watchWs = new WebSocket(wsUrl, wsProtocols());
+
+            watchWs.onopen = () => {
+                // The server replays every existing pod as "added" first
+                podContainers = {};
+                watchReconnectDelay = 2000;
+                status.textContent = 'Live updates: connected';
+                status.className = 'text-sm text-green-600';
+            };
+
+            watchWs.onmessage = (event) => {
+                const data = JSON.parse(event.data);
+                if (data.error) {
+                    console.error('Container watch error:', data.error);
+                    return;
+                }
+                if (data.type === 'deleted') {
+                    delete podContainers[data.pod];
+                } else {
+                    podContainers[data.pod] = data.containers;
+                }
+                updateContainers();
+            };
+
+            watchWs.onclose = (event) => {
+                watchWs = null;
+                status.textContent = 'Live updates: reconnecting...';
+                status.className = 'text-sm text-yellow-600';
+                const restart = restartDelay(event);
+                if (restart !== null) {
+                    setTimeout(connectContainerWatch, restart);
+                    return;
+                }
+                setTimeout(connectContainerWatch, watchReconnectDelay);
+                watchReconnectDelay = Math.min(watchReconnectDelay * 2, 30000);
+            };
+        }
+
+        // Escape text for use in HTML markup and attribute values. Pod specs
+        // and statuses are written by whoever can create pods, so everything
+        // from the API goes through this before reaching innerHTML.
+        function escapeHtml(value) {
+            return String(value).replace(/[&<>"']/g, ch => ({
+                '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'
+            })[ch]);
+        }
+
         // Render containers in sidebar
         function renderContainers(containersToRender) {
             const listElement = document.getElementById('containers-list');
@@ -177,14 +373,20 @@ func getHTMLUI() string {
 
             listElement.innerHTML = containersToRender.map(c => {
                 const isActive = currentPod === c.podName && currentContainer === c.containerName;
+                const details = 'Image: ' + c.image + '\nNode: ' + (c.nodeName || 'unscheduled') + '\nPod phase: ' + c.podPhase;
                 return ` + "`" + `
                 <div class="container-item p-3 mb-2 rounded-md cursor-pointer border border-gray-200 ${isActive ? 'active' : ''}"
-                     data-pod="${c.podName}"
-                     data-container="${c.containerName}">
+                     data-pod="${escapeHtml(c.podName)}"
+                     data-container="${escapeHtml(c.containerName)}"
+                     title="${escapeHtml(details)}">
                     <div class="flex justify-between items-center">
                         <div class="flex-1">
-                            <div class="font-semibold text-sm">${c.containerName}</div>
-                            <div class="text-xs ${isActive ? 'text-blue-200' : 'text-gray-500'}">${c.podName}</div>
+                            <div class="font-semibold text-sm">
+                                ${escapeHtml(c.containerName)}
+                                ${c.type && c.type !== 'regular' ? '<span class="ml-1 px-1.5 py-0.5 rounded text-xs font-normal bg-purple-100 text-purple-800">' + escapeHtml(c.type) + '</span>' : ''}
+                            </div>
+                            <div class="text-xs ${isActive ? 'text-blue-200' : 'text-gray-500'}">${escapeHtml(c.podName)}</div>
+                            <div class="mt-1 flex flex-wrap gap-1">${containerBadges(c)}</div>
                         </div>
                         ${isActive ? '<div class="spinner ml-2"></div>' : ''}
                     </div>
@@ -202,6 +404,34 @@ func getHTMLUI() string {
             });
         }
 
+        // Status badges for a container: state/reason, readiness and restarts
+        function containerBadges(c) {
+            const badge = (text, classes) => '<span class="px-1.5 py-0.5 rounded text-xs ' + classes + '">' + escapeHtml(text) + '</span>';
+            const badges = [];
+
+            if (c.state === 'running') {
+                badges.push(badge('running', 'bg-green-100 text-green-800'));
+            } else if (c.state === 'waiting') {
+                badges.push(badge(c.reason || 'waiting', 'bg-yellow-100 text-yellow-800'));
+            } else if (c.state === 'terminated') {
+                const failed = c.exitCode !== undefined && c.exitCode !== 0;
+                badges.push(badge((c.reason || 'terminated') + (failed ? ' (' + c.exitCode + ')' : ''),
+                    failed ? 'bg-red-100 text-red-800' : 'bg-gray-100 text-gray-700'));
+            } else {
+                badges.push(badge(c.podPhase || 'unknown', 'bg-gray-100 text-gray-700'));
+            }
+
+            if (c.state === 'running' && !c.ready) {
+                badges.push(badge('not ready', 'bg-orange-100 text-orange-800'));
+            }
+            if (c.restartCount > 0) {
+                badges.push(badge(c.restartCount + (c.restartCount === 1 ? ' restart' : ' restarts'),
+                    c.restartCount >= 5 ? 'bg-red-100 text-red-800' : 'bg-yellow-100 text-yellow-800'));
+            }
+
+            return badges.join('');
+        }
+
         // Select a container and start streaming logs
         function selectContainer(pod, container) {
             currentPod = pod;
@@ -216,28 +446,97 @@ func getHTMLUI() string {
             document.getElementById('selected-pod').textContent = 'Pod: ' + pod;
 
             // Re-render containers to show spinner on active container
-            renderContainers(containers);
+            renderFilteredContainers();
 
             // Clear existing logs
             clearLogs();
+            lastLine = null;
+
+            // Close the existing stream and follow the new container
+            closeLogStream();
+            if (useEventStream) {
+                connectEventStream(pod, container);
+            } else {
+                connectWebSocket(pod, container);
+            }
+        }
 
-            // Close existing WebSocket
+        function closeLogStream() {
             if (ws) {
                 ws.close();
             }
+            if (eventSource) {
+                eventSource.close();
+                eventSource = null;
+            }
+        }
 
-            // Connect WebSocket
-            connectWebSocket(pod, container);
+        // Show a message from the log stream
+        function handleLogMessage(data) {
+            if (data.timestamp && data.hash) {
+                lastLine = { timestamp: data.timestamp, hash: data.hash };
+            }
+            if (data.error) {
+                appendLog('ERROR: ' + data.error, 'text-red-400');
+            } else if (data.gap) {
+                appendLog(data.log, 'text-yellow-400');
+            } else if (data.fields) {
+                appendStructuredLog(data);
+            } else if (data.log) {
+                appendLog(data.log, data.context ? 'text-gray-500' : undefined, data.timestamp);
+            }
+        }
+
+        // Follow logs with Server-Sent Events. The browser reconnects by
+        // itself, sending the ID of the last event, so nothing is repeated.
+        function connectEventStream(pod, container) {
+            const path = '/api' + namespacePath() + '/logs/' + encodeURIComponent(pod) + '/' + encodeURIComponent(container) + '/stream';
+            const source = new EventSource(API_KEY ? path + '?key=' + encodeURIComponent(API_KEY) : path);
+            eventSource = source;
+            let lost = false;
+
+            source.onopen = () => {
+                if (lost) {
+                    appendLog('--- Reconnected to log stream ---', 'text-green-400');
+                    lost = false;
+                }
+                console.log('Event stream connected for', pod, container);
+            };
+
+            source.onmessage = (event) => {
+                handleLogMessage(JSON.parse(event.data));
+            };
+
+            source.onerror = () => {
+                if (eventSource !== source) {
+                    return;
+                }
+                if (source.readyState === EventSource.CLOSED) {
+                    // The server refused the stream; the browser won't retry
+                    appendLog('--- Connection lost. Click the container again to reconnect. ---', 'text-red-400');
+                    eventSource = null;
+                } else if (!lost) {
+                    lost = true;
+                    appendLog('--- Connection lost. Reconnecting... ---', 'text-yellow-400');
+                }
+            };
         }
 
         // Connect to WebSocket for real-time logs
         function connectWebSocket(pod, container, isReconnect = false) {
             const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-            const wsUrl = protocol + '//' + window.location.host + '/ws/logs/' + encodeURIComponent(pod) + '/' + encodeURIComponent(container) + (API_KEY ? '?key=' + encodeURIComponent(API_KEY) : '');
+            let wsUrl = protocol + '//' + window.location.host + '/ws' + namespacePath() + '/logs/' + encodeURIComponent(pod) + '/' + encodeURIComponent(container);
+            if (isReconnect && lastLine) {
+                // Pick up lines written while disconnected without repeating any
+                wsUrl += '?resumeFrom=' + encodeURIComponent(lastLine.timestamp + ',' + lastLine.hash);
+            }
 
-            ws = new WebSocket(wsUrl);
+            ws = new WebSocket(wsUrl, wsProtocols());
+            const socket = ws;
+            let opened = false;
 
             ws.onopen = () => {
+                opened = true;
                 // Connection established - reset reconnect counter
                 reconnectAttempts = 0;
                 reconnectDelay = 2000;
@@ -248,12 +547,7 @@ func getHTMLUI() string {
             };
 
             ws.onmessage = (event) => {
-                const data = JSON.parse(event.data);
-                if (data.error) {
-                    appendLog('ERROR: ' + data.error, 'text-red-400');
-                } else if (data.log) {
-                    appendLog(data.log);
-                }
+                handleLogMessage(JSON.parse(event.data));
             };
 
             ws.onerror = (error) => {
@@ -265,7 +559,24 @@ func getHTMLUI() string {
 
                 // Only attempt to reconnect if we're still viewing this container
                 if (currentPod === pod && currentContainer === container) {
-                    if (reconnectAttempts < maxReconnectAttempts) {
+                    if (!opened && !isReconnect && ws === socket && restartDelay(event) === null) {
+                        // The WebSocket never got through; try Server-Sent Events
+                        useEventStream = true;
+                        appendLog('--- WebSocket unavailable, following with Server-Sent Events ---', 'text-yellow-400');
+                        connectEventStream(pod, container);
+                        return;
+                    }
+                    // A server restart is expected during rollouts and doesn't
+                    // use up a reconnect attempt
+                    const restart = restartDelay(event);
+                    if (restart !== null) {
+                        appendLog('--- Server restarting. Reconnecting in ' + (restart / 1000) + 's... ---', 'text-yellow-400');
+                        setTimeout(() => {
+                            if (currentPod === pod && currentContainer === container) {
+                                connectWebSocket(pod, container, true);
+                            }
+                        }, restart);
+                    } else if (reconnectAttempts < maxReconnectAttempts) {
                         reconnectAttempts++;
                         const delay = reconnectDelay * reconnectAttempts;
                         appendLog('--- Connection lost. Reconnecting in ' + (delay / 1000) + 's... (attempt ' + reconnectAttempts + '/' + maxReconnectAttempts + ') ---', 'text-yellow-400');
@@ -283,19 +594,110 @@ func getHTMLUI() string {
             };
         }
 
-        // Append a log line
-        function appendLog(text, colorClass = 'text-gray-100') {
-            const logsContainer = document.getElementById('logs-container');
+        // Append a log line. Lines with a container timestamp show it and are
+        // kept in timestamp order; status lines without one go at the end.
+        function appendLog(text, colorClass = 'text-gray-100', timestamp) {
             const logLine = document.createElement('div');
             logLine.className = 'log-line ' + colorClass;
-            logLine.textContent = text;
-            logsContainer.appendChild(logLine);
+            if (timestamp) {
+                logLine.appendChild(timeLabel(timestamp));
+            }
+            logLine.appendChild(document.createTextNode(text));
+            insertLogLine(logLine, timestamp);
+        }
+
+        // Sortable key for an RFC3339Nano timestamp. The kubelet trims trailing
+        // zeros from the fraction, so pad it to nine digits before comparing.
+        function timestampKey(timestamp) {
+            const match = /^(.*T\d\d:\d\d:\d\d)(?:\.(\d+))?(.*)$/.exec(timestamp);
+            if (!match) {
+                return timestamp;
+            }
+            return match[1] + '.' + (match[2] || '').padEnd(9, '0') + match[3];
+        }
+
+        // Short HH:MM:SS.mmm label for a log timestamp, full value on hover
+        function timeLabel(timestamp) {
+            const span = document.createElement('span');
+            span.className = 'log-time';
+            span.title = timestamp;
+            const date = new Date(timestamp);
+            span.textContent = isNaN(date) ? timestamp : date.toLocaleTimeString([], { hour12: false }) + '.' + String(date.getMilliseconds()).padStart(3, '0');
+            return span;
+        }
+
+        // Insert a log element after the last line with an earlier or equal
+        // timestamp, so lines delivered out of order still read chronologically.
+        // Lines without a timestamp are never moved past.
+        function insertLogLine(element, timestamp) {
+            const logsContainer = document.getElementById('logs-container');
+            if (timestamp) {
+                element.dataset.ts = timestampKey(timestamp);
+                let after = logsContainer.lastElementChild;
+                while (after && after.dataset.ts && after.dataset.ts > element.dataset.ts) {
+                    after = after.previousElementSibling;
+                }
+                if (after) {
+                    after.after(element);
+                } else {
+                    logsContainer.prepend(element);
+                }
+            } else {
+                logsContainer.appendChild(element);
+            }
 
             if (autoScroll) {
                 logsContainer.scrollTop = logsContainer.scrollHeight;
             }
         }
 
+        // Text color for a normalized log level
+        function levelClass(level) {
+            switch (level) {
+                case 'fatal':
+                case 'error':
+                    return 'text-red-400';
+                case 'warn':
+                    return 'text-yellow-300';
+                case 'debug':
+                case 'trace':
+                    return 'text-gray-400';
+                default:
+                    return 'text-gray-100';
+            }
+        }
+
+        // Append a JSON/logfmt line as a summary that expands into key/value rows
+        function appendStructuredLog(data) {
+            const details = document.createElement('details');
+            details.className = 'log-line ' + (data.context ? 'text-gray-500' : levelClass(data.level));
+
+            const summary = document.createElement('summary');
+            const parts = [];
+            if (data.level) {
+                parts.push('[' + data.level.toUpperCase() + ']');
+            }
+            parts.push(data.msg || data.log);
+            if (data.timestamp) {
+                summary.appendChild(timeLabel(data.timestamp));
+            }
+            summary.appendChild(document.createTextNode('▸ ' + parts.join(' ')));
+            details.appendChild(summary);
+
+            const table = document.createElement('table');
+            table.className = 'log-fields ml-4 text-gray-300';
+            Object.keys(data.fields).sort().forEach(key => {
+                const row = table.insertRow();
+                const keyCell = row.insertCell();
+                keyCell.className = 'text-blue-300';
+                keyCell.textContent = key;
+                const value = data.fields[key];
+                row.insertCell().textContent = typeof value === 'object' ? JSON.stringify(value) : String(value);
+            });
+            details.appendChild(table);
+            insertLogLine(details, data.timestamp);
+        }
+
         // Clear logs
         function clearLogs() {
             document.getElementById('logs-container').innerHTML = '';
@@ -307,20 +709,23 @@ func getHTMLUI() string {
             listElement.innerHTML = ` + "`" + `
                 <div class="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded">
                     <p class="font-bold">Error</p>
-                    <p class="text-sm">${message}</p>
+                    <p class="text-sm">${escapeHtml(message)}</p>
                 </div>
             ` + "`" + `;
         }
 
-        // Search containers
-        document.getElementById('search-containers').addEventListener('input', (e) => {
-            const searchTerm = e.target.value.toLowerCase();
+        // Render containers matching the current search term
+        function renderFilteredContainers() {
+            const searchTerm = document.getElementById('search-containers').value.toLowerCase();
             const filtered = containers.filter(c =>
                 c.containerName.toLowerCase().includes(searchTerm) ||
                 c.podName.toLowerCase().includes(searchTerm)
             );
             renderContainers(filtered);
-        });
+        }
+
+        // Search containers
+        document.getElementById('search-containers').addEventListener('input', renderFilteredContainers);
 
         // Toggle auto-scroll
         document.getElementById('auto-scroll-btn').addEventListener('click', () => {
@@ -335,17 +740,29 @@ func getHTMLUI() string {
         // Clear logs button
         document.getElementById('clear-logs-btn').addEventListener('click', clearLogs);
 
-        // Refresh containers button
-        document.getElementById('refresh-btn').addEventListener('click', loadContainers);
+        // Download the full log of the selected container
+        document.getElementById('download-logs-btn').addEventListener('click', () => {
+            if (!currentPod || !currentContainer) {
+                return;
+            }
+            const path = '/api' + namespacePath() + '/logs/' + encodeURIComponent(currentPod) + '/' + encodeURIComponent(currentContainer) + '/download';
+            window.location.href = API_KEY ? path + '?key=' + encodeURIComponent(API_KEY) : path;
+        });
+
+        // Namespace switcher
+        document.getElementById('namespace-select').addEventListener('change', (e) => switchNamespace(e.target.value));
 
         // Initialize
         loadVersion();
-        loadContainers();
+        loadSession();
+        loadContainers().then(loadNamespaces);
 
         // Cleanup on page unload
         window.addEventListener('beforeunload', () => {
-            if (ws) {
-                ws.close();
+            closeLogStream();
+            if (watchWs) {
+                watchWs.onclose = null;
+                watchWs.close();
             }
         });
     </script>
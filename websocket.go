@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WebSocket keepalive timing. The server pings every wsPingInterval and
+// drops a client that hasn't answered within wsPongWait, so a vanished
+// browser is noticed even on a quiet stream. A write that takes longer than
+// wsWriteWait means the client stopped reading.
+const (
+	wsPongWait     = 60 * time.Second
+	wsPingInterval = wsPongWait * 9 / 10
+	wsWriteWait    = 10 * time.Second
+)
+
+// wsSession is an upgraded WebSocket serving one stream. Its context ends
+// with the request, when the client closes or stops answering pings, and
+// when the server shuts down; on shutdown the client is first sent a
+// "service restart" close frame with a retry hint, so it reconnects to
+// another replica instead of giving up.
+type wsSession struct {
+	conn   *websocket.Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   func()
+	// sent counts bytes written for the audit log, if not nil
+	sent *atomic.Int64
+	// open is the route's websocket_connections gauge
+	open prometheus.Gauge
+
+	writeMu sync.Mutex
+}
+
+// upgradeSession upgrades the request to a WebSocket tracked by d. While
+// the server is draining it answers 503 instead.
+func upgradeSession(c *gin.Context, upgrader *websocket.Upgrader, d *drainer) (*wsSession, bool) {
+	done, ok := d.track()
+	if !ok {
+		c.Header("Retry-After", fmt.Sprint(int(shutdownRetryAfter/time.Second)))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "server is shutting down"})
+		return nil, false
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		done()
+		fmt.Println("WebSocket upgrade failed:", err)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	s := &wsSession{conn: conn, ctx: ctx, cancel: cancel, done: done, sent: auditCounter(c)}
+	s.open = websocketConnections.WithLabelValues(c.FullPath())
+	s.open.Inc()
+	go s.readLoop()
+	go s.keepalive(d.ctx.Done())
+	return s, true
+}
+
+// readLoop discards what the client sends and ends the session when the
+// connection closes or the pong deadline passes. Clients never send data,
+// but only reading notices a close frame.
+func (s *wsSession) readLoop() {
+	defer s.cancel()
+	s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		if _, _, err := s.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// keepalive pings the client until the session ends, and sends the
+// restart close frame if shutdown comes first.
+func (s *wsSession) keepalive(shutdown <-chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-shutdown:
+			s.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseServiceRestart, shutdownCloseReason),
+				time.Now().Add(time.Second))
+			s.cancel()
+			return
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				s.cancel()
+				return
+			}
+		}
+	}
+}
+
+// WriteJSON sends a message, serializing concurrent writers. A client that
+// doesn't take it within wsWriteWait ends the session.
+func (s *wsSession) WriteJSON(v interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	if err := s.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		s.cancel()
+		return err
+	}
+	if s.sent != nil {
+		s.sent.Add(int64(len(data)))
+	}
+	return nil
+}
+
+// Close cancels the session's context, closes the connection and marks the
+// stream as finished.
+func (s *wsSession) Close() {
+	s.cancel()
+	s.conn.Close()
+	s.open.Dec()
+	s.done()
+}
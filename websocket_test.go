@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestWebSocketSessionEndsOnClientClose tests that a closed browser tab ends its stream without waiting for a write
+func TestWebSocketSessionEndsOnClientClose(t *testing.T) {
+	router := newTestRouter(t, "", testPod("web-1", "app"))
+	handlerDone := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r)
+		close(handlerDone)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/containers/watch", nil)
+	require.NoError(t, err)
+	var msg map[string]interface{}
+	require.NoError(t, conn.ReadJSON(&msg))
+
+	// The watch is quiet from here on, so only the read loop can notice
+	conn.Close()
+	select {
+	case <-handlerDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler outlived its client")
+	}
+}
+
+// TestOpenLogStreamCounts tests that the upstream stream gauge follows opens and closes
+func TestOpenLogStreamCounts(t *testing.T) {
+	before := upstreamStreams.Load()
+	clientset := fake.NewSimpleClientset()
+
+	stream, err := openLogStream(context.Background(), clientset.CoreV1().Pods("default").GetLogs("web-1", &corev1.PodLogOptions{}))
+	require.NoError(t, err)
+	assert.Equal(t, before+1, upstreamStreams.Load())
+
+	stream.Close()
+	stream.Close()
+	assert.Equal(t, before, upstreamStreams.Load(), "closing twice counts once")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Browsers can't set headers on WebSocket requests, but can offer
+// subprotocols. Clients offer wsProtocol, which the server selects, and
+// may pass their API key as another protocol: wsKeyProtocolPrefix followed
+// by the key in unpadded base64url. That protocol is never echoed back.
+const (
+	wsProtocol          = "k8s-simple-logs"
+	wsKeyProtocolPrefix = "k8s-simple-logs.key."
+)
+
+// wsTicketTTL is how long a ticket from /api/ws-ticket stays valid. It is
+// only needed for the moment between fetching it and connecting.
+const wsTicketTTL = 30 * time.Second
+
+// wsTicketContextKeys are the gin context keys a ticket carries over from
+// the request that obtained it to the WebSocket that redeems it.
+var wsTicketContextKeys = []string{userKey, kubeUserKey, apiKeyContextKey, authMethodKey}
+
+// wsProtocolKey returns the API key offered as a WebSocket subprotocol.
+func wsProtocolKey(r *http.Request) string {
+	for _, protocol := range websocketProtocols(r) {
+		if encoded, ok := strings.CutPrefix(protocol, wsKeyProtocolPrefix); ok {
+			key, err := base64.RawURLEncoding.DecodeString(encoded)
+			if err != nil {
+				return ""
+			}
+			return string(key)
+		}
+	}
+	return ""
+}
+
+func websocketProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocols = append(protocols, strings.TrimSpace(protocol))
+		}
+	}
+	return protocols
+}
+
+// wsTicket is an identity waiting to be picked up by a WebSocket.
+type wsTicket struct {
+	values  map[string]interface{}
+	expires time.Time
+}
+
+// wsTicketStore hands out single-use tickets that authenticate one
+// WebSocket as the caller who asked for them, so the key or token itself
+// never has to appear in a URL.
+type wsTicketStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	tickets map[string]wsTicket
+}
+
+func newWSTicketStore() *wsTicketStore {
+	return &wsTicketStore{ttl: wsTicketTTL, tickets: map[string]wsTicket{}}
+}
+
+// issue returns a new ticket for the authenticated caller of c.
+func (s *wsTicketStore) issue(c *gin.Context) (string, error) {
+	ticket, err := randomString()
+	if err != nil {
+		return "", err
+	}
+	values := map[string]interface{}{}
+	for _, key := range wsTicketContextKeys {
+		if value, ok := c.Get(key); ok {
+			values[key] = value
+		}
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t, entry := range s.tickets {
+		if now.After(entry.expires) {
+			delete(s.tickets, t)
+		}
+	}
+	s.tickets[ticket] = wsTicket{values: values, expires: now.Add(s.ttl)}
+	return ticket, nil
+}
+
+// redeem authenticates c as the caller ticket was issued to. A ticket works
+// once.
+func (s *wsTicketStore) redeem(c *gin.Context, ticket string) bool {
+	s.mu.Lock()
+	entry, ok := s.tickets[ticket]
+	delete(s.tickets, ticket)
+	s.mu.Unlock()
+	if !ok || time.Now().After(entry.expires) {
+		return false
+	}
+	for key, value := range entry.values {
+		c.Set(key, value)
+	}
+	return true
+}
+
+// handler issues a ticket: {"ticket": "...", "expiresIn": 30}.
+func (s *wsTicketStore) handler(c *gin.Context) {
+	ticket, err := s.issue(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expiresIn": int(s.ttl / time.Second)})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWebSocketAuth tests every way a WebSocket can pass the key
+func TestWebSocketAuth(t *testing.T) {
+	server := httptest.NewServer(newTestRouter(t, "secret", testPod("web-1", "app")))
+	defer server.Close()
+	base := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/logs/web-1/app"
+
+	dial := func(query string, header http.Header) (*websocket.Conn, *http.Response, error) {
+		return websocket.DefaultDialer.Dial(base+query, header)
+	}
+	protocols := func(key string) http.Header {
+		return http.Header{"Sec-WebSocket-Protocol": {wsProtocol + ", " + wsKeyProtocolPrefix + base64.RawURLEncoding.EncodeToString([]byte(key))}}
+	}
+
+	conn, resp, err := dial("", protocols("secret"))
+	require.NoError(t, err)
+	assert.Equal(t, wsProtocol, resp.Header.Get("Sec-WebSocket-Protocol"), "the key is never echoed back")
+	conn.Close()
+
+	conn, _, err = dial("", http.Header{"X-API-Key": {"secret"}})
+	require.NoError(t, err)
+	conn.Close()
+
+	conn, _, err = dial("?key=secret", nil)
+	require.NoError(t, err)
+	conn.Close()
+
+	_, resp, err = dial("", protocols("wrong"))
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// A ticket works once
+	req, _ := http.NewRequest("POST", server.URL+"/api/ws-ticket", nil)
+	req.Header.Set("X-API-Key", "secret")
+	ticketResp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	var body struct {
+		Ticket    string `json:"ticket"`
+		ExpiresIn int    `json:"expiresIn"`
+	}
+	require.NoError(t, json.NewDecoder(ticketResp.Body).Decode(&body))
+	ticketResp.Body.Close()
+	assert.Equal(t, int(wsTicketTTL/time.Second), body.ExpiresIn)
+
+	conn, _, err = dial("?ticket="+body.Ticket, nil)
+	require.NoError(t, err)
+	conn.Close()
+	_, resp, err = dial("?ticket="+body.Ticket, nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Tickets need authentication
+	ticketResp, err = http.Post(server.URL+"/api/ws-ticket", "", nil)
+	require.NoError(t, err)
+	ticketResp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, ticketResp.StatusCode)
+}
+
+// TestWebSocketTicketCarriesIdentity tests that a ticket authenticates as whoever obtained it, until it expires
+func TestWebSocketTicketCarriesIdentity(t *testing.T) {
+	store := newWSTicketStore()
+	issuer, _ := gin.CreateTestContext(httptest.NewRecorder())
+	issuer.Set(userKey, "alice")
+	issuer.Set(authMethodKey, authMethodOIDC)
+	ticket, err := store.issue(issuer)
+	require.NoError(t, err)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	require.True(t, store.redeem(c, ticket))
+	assert.Equal(t, "alice", c.GetString(userKey))
+	assert.Equal(t, authMethodOIDC, c.GetString(authMethodKey))
+
+	store.ttl = -time.Second
+	expired, err := store.issue(issuer)
+	require.NoError(t, err)
+	assert.False(t, store.redeem(c, expired))
+}
+
+// TestWebSocketOrigins tests that only the same origin may connect unless others are allowed
+func TestWebSocketOrigins(t *testing.T) {
+	server := httptest.NewServer(newTestRouter(t, "", testPod("web-1", "app")))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/logs/web-1/app"
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {server.URL}})
+	require.NoError(t, err)
+	conn.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.com"}})
+	require.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	upgrader := newUpgrader([]string{"https://logs.example.com"})
+	r := httptest.NewRequest("GET", "/ws/logs/web-1/app", nil)
+	r.Header.Set("Origin", "https://logs.example.com")
+	assert.True(t, upgrader.CheckOrigin(r))
+	r.Header.Set("Origin", "http://"+r.Host)
+	assert.False(t, upgrader.CheckOrigin(r), "an explicit list replaces same-origin")
+}